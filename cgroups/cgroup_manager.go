@@ -2,46 +2,152 @@ package cgroups
 
 import (
 	"minidocker/cgroups/subsystems"
+	"os"
+	"path"
 
 	"github.com/sirupsen/logrus"
 )
 
-type CgroupManager struct {
-  Path string
-  Resource *subsystems.ResourceConfig
+type CgroupManager interface {
+	// pid join the cgroup
+	Apply(pid int) error
+	// set cgroup rule
+	Set(res *subsystems.ResourceConfig) error
+	// 更新运行中容器的资源限制, pids为容器中的进程
+	Update(res *subsystems.ResourceConfig, pids []int) error
+	// destroy cgroup
+	Destroy()
 }
 
-func NewCgroupManager(path string) *CgroupManager {
-  return &CgroupManager{
-    Path: path,
-  }
+// 根据宿主机的cgroup版本创建对应的manager
+func NewCgroupManager(path string) CgroupManager {
+	if subsystems.IsCgroup2UnifiedMode() {
+		return NewCgroupManagerV2(path)
+	}
+	return NewCgroupManagerV1(path)
+}
+
+// cgroup v1, 每个subsystem挂载在各自的hierarchy下
+type CgroupManagerV1 struct {
+	Path     string
+	Resource *subsystems.ResourceConfig
+	// 当前容器的subsystem实例
+	subsystems []subsystems.Subsystem
+}
+
+func NewCgroupManagerV1(path string) *CgroupManagerV1 {
+	return &CgroupManagerV1{
+		Path:       path,
+		subsystems: subsystems.NewSubsystems(),
+	}
+}
+
+// 宿主机没有挂载的subsystem直接跳过
+func (c *CgroupManagerV1) mounted(subSys subsystems.Subsystem) bool {
+	if subsystems.FindCgroupMountPoint(subSys.Name()) == "" {
+		logrus.Warnf("cgroup subsystem %s is not mounted, skip", subSys.Name())
+		return false
+	}
+	return true
 }
 
 // pid join the cgroup
-func (c *CgroupManager) Apply(pid int) error {
-  for _, subSysIns := range(subsystems.SubsystemsIns) {
-    if err := subSysIns.Apply(c.Path, pid); err != nil {
-      return err
-    }
-  }
-  return nil
+func (c *CgroupManagerV1) Apply(pid int) error {
+	for _, subSysIns := range c.subsystems {
+		if !c.mounted(subSysIns) {
+			continue
+		}
+		if err := subSysIns.Apply(c.Path, pid); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // set cgroup rule
-func (c *CgroupManager) Set(res *subsystems.ResourceConfig) error {
-  for _, subSysIns := range(subsystems.SubsystemsIns) {
-    if err := subSysIns.Set(c.Path, res); err != nil {
-      return err
-    }
-  }
-  return nil
+func (c *CgroupManagerV1) Set(res *subsystems.ResourceConfig) error {
+	return c.set(res, c.subsystems)
+}
+
+// 任何一个subsystem失败时, 删除本次创建的cgroup目录
+func (c *CgroupManagerV1) set(res *subsystems.ResourceConfig, subSystems []subsystems.Subsystem) error {
+	var created []string
+	for _, subSysIns := range subSystems {
+		if !c.mounted(subSysIns) {
+			continue
+		}
+		missing := missingDirs(subsystems.FindCgroupMountPoint(subSysIns.Name()), c.Path)
+		err := subSysIns.Set(c.Path, res)
+		for _, dir := range missing {
+			if _, err := os.Stat(dir); err == nil {
+				created = append(created, dir)
+			}
+		}
+		if err != nil {
+			rollback(created)
+			return err
+		}
+	}
+	c.Resource = res
+	return nil
+}
+
+// 运行中更新时跳过devices, 重新写入deny a会短暂禁止容器访问所有设备
+func updatableSubsystems(subSystems []subsystems.Subsystem) []subsystems.Subsystem {
+	var result []subsystems.Subsystem
+	for _, subSysIns := range subSystems {
+		if subSysIns.Name() != "devices" {
+			result = append(result, subSysIns)
+		}
+	}
+	return result
+}
+
+// 更新资源限制, run时没有设置的subsystem会新建cgroup, 需要将容器进程加入其中
+func (c *CgroupManagerV1) Update(res *subsystems.ResourceConfig, pids []int) error {
+	subSystems := updatableSubsystems(c.subsystems)
+	if err := c.set(res, subSystems); err != nil {
+		return err
+	}
+	for _, subSysIns := range subSystems {
+		if !c.mounted(subSysIns) {
+			continue
+		}
+		for _, pid := range pids {
+			if err := subSysIns.Apply(c.Path, pid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 从上到下列出cgroupPath中还不存在的目录, 包括父目录
+func missingDirs(root string, cgroupPath string) []string {
+	var missing []string
+	for dir := path.Join(root, cgroupPath); dir != root && dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append([]string{dir}, missing...)
+	}
+	return missing
+}
+
+// 逆序删除创建的cgroup目录
+func rollback(created []string) {
+	for i := len(created) - 1; i >= 0; i-- {
+		if err := os.Remove(created[i]); err != nil {
+			logrus.Warnf("rollback cgroup %s error %v", created[i], err)
+		}
+	}
 }
 
 // destroy cgroup
-func (c *CgroupManager) Destroy() {
-  for _, subSysIns := range(subsystems.SubsystemsIns) {
-    if err := subSysIns.Remove(c.Path); err != nil {
-      logrus.Warnf("remove cgroup fail %v", err)
-    }
-  }
+func (c *CgroupManagerV1) Destroy() {
+	for _, subSysIns := range c.subsystems {
+		if err := subSysIns.Remove(c.Path); err != nil {
+			logrus.Warnf("remove cgroup fail %v", err)
+		}
+	}
 }
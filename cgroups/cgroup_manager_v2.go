@@ -0,0 +1,130 @@
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"minidocker/cgroups/subsystems"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 容器需要使用的controller
+var v2Controllers = []string{"cpu", "cpuset", "memory", "io", "pids"}
+
+// cgroup v2, 所有controller共用unified hierarchy下的同一个目录
+type CgroupManagerV2 struct {
+	Path     string
+	Resource *subsystems.ResourceConfig
+	// unified hierarchy的挂载点
+	mountPoint string
+	// 当前容器的subsystem实例
+	subsystems []subsystems.Subsystem
+}
+
+func NewCgroupManagerV2(path string) *CgroupManagerV2 {
+	return &CgroupManagerV2{
+		Path:       path,
+		mountPoint: subsystems.FindCgroup2MountPoint(),
+		subsystems: subsystems.NewSubsystems(),
+	}
+}
+
+func (c *CgroupManagerV2) dir() string {
+	return path.Join(c.mountPoint, c.Path)
+}
+
+// 在父cgroup的cgroup.subtree_control中开启controller, 子cgroup才能使用
+func enableControllers(dir string) error {
+	content, err := ioutil.ReadFile(path.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	available := strings.Fields(string(content))
+	var enable []string
+	for _, controller := range v2Controllers {
+		for _, a := range available {
+			if a == controller {
+				enable = append(enable, "+"+controller)
+			}
+		}
+	}
+	if len(enable) == 0 {
+		return nil
+	}
+	return ioutil.WriteFile(path.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0644)
+}
+
+// 从挂载点开始逐级开启controller并创建容器的cgroup目录
+// 返回本次创建的目录, 用于失败时回滚
+func (c *CgroupManagerV2) create() ([]string, error) {
+	rel, err := filepath.Rel(c.mountPoint, c.dir())
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("invalid cgroup path %s", c.Path)
+	}
+	var created []string
+	current := c.mountPoint
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		if err := enableControllers(current); err != nil {
+			// 父cgroup中有进程时无法开启, 此时只能使用已经开启的controller
+			logrus.Warnf("enable controllers in %s error %v", current, err)
+		}
+		current = path.Join(current, elem)
+		if err := os.Mkdir(current, 0755); err == nil {
+			created = append(created, current)
+		} else if !os.IsExist(err) {
+			rollback(created)
+			return nil, fmt.Errorf("error create cgroup %v", err)
+		}
+	}
+	return created, nil
+}
+
+// pid join the cgroup
+func (c *CgroupManagerV2) Apply(pid int) error {
+	if _, err := c.create(); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(c.dir(), "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+// set cgroup rule
+func (c *CgroupManagerV2) Set(res *subsystems.ResourceConfig) error {
+	return c.set(res, c.subsystems)
+}
+
+// 更新资源限制, v2只有一个cgroup, 容器进程已经在其中
+func (c *CgroupManagerV2) Update(res *subsystems.ResourceConfig, _ []int) error {
+	return c.set(res, updatableSubsystems(c.subsystems))
+}
+
+// 任何一个subsystem失败时, 删除本次创建的cgroup目录
+func (c *CgroupManagerV2) set(res *subsystems.ResourceConfig, subSystems []subsystems.Subsystem) error {
+	created, err := c.create()
+	if err != nil {
+		return err
+	}
+	// subsystem在v2模式下写入memory.max, cpu.weight等文件
+	for _, subSysIns := range subSystems {
+		if err := subSysIns.Set(c.Path, res); err != nil {
+			rollback(created)
+			return err
+		}
+	}
+	c.Resource = res
+	return nil
+}
+
+// destroy cgroup
+func (c *CgroupManagerV2) Destroy() {
+	if err := os.Remove(c.dir()); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("remove cgroup fail %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package cgroups
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// 将systemd风格的slice展开为目录, 如 a-b.slice 展开为 a.slice/a-b.slice
+func expandSlice(slice string) (string, error) {
+	name := strings.TrimSuffix(slice, ".slice")
+	// -.slice是根slice
+	if name == "-" {
+		return "", nil
+	}
+	if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, "-") ||
+		strings.HasSuffix(name, "-") || strings.Contains(name, "--") {
+		return "", fmt.Errorf("invalid slice name %s", slice)
+	}
+	var dirs []string
+	prefix := ""
+	for _, part := range strings.Split(name, "-") {
+		prefix += part
+		dirs = append(dirs, prefix+".slice")
+		prefix += "-"
+	}
+	return path.Join(dirs...), nil
+}
+
+// 校验--cgroup-parent, 只允许相对于cgroup根目录的路径
+func ValidateCgroupParent(parent string) error {
+	_, err := CgroupPath(parent, "test")
+	return err
+}
+
+// 计算容器的cgroup路径
+// parent是slice时使用 minidocker-<id>.scope 作为容器的cgroup, 否则使用容器id
+func CgroupPath(parent string, containerId string) (string, error) {
+	if parent == "" {
+		return containerId, nil
+	}
+	for _, elem := range strings.Split(parent, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("invalid cgroup parent %s", parent)
+		}
+	}
+	if strings.HasSuffix(parent, ".slice") && !strings.Contains(parent, "/") {
+		dir, err := expandSlice(parent)
+		if err != nil {
+			return "", err
+		}
+		return path.Join(dir, "minidocker-"+containerId+".scope"), nil
+	}
+	return path.Join(strings.TrimPrefix(path.Clean("/"+parent), "/"), containerId), nil
+}
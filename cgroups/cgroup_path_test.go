@@ -0,0 +1,32 @@
+package cgroups
+
+import "testing"
+
+func TestCgroupPath(t *testing.T) {
+	cases := []struct {
+		parent string
+		want   string
+		fail   bool
+	}{
+		{"", "123", false},
+		{"minidocker", "minidocker/123", false},
+		{"/agent/minidocker/", "agent/minidocker/123", false},
+		{"minidocker.slice", "minidocker.slice/minidocker-123.scope", false},
+		{"minidocker-web.slice", "minidocker.slice/minidocker-web.slice/minidocker-123.scope", false},
+		{"-.slice", "minidocker-123.scope", false},
+		{"minidocker--web.slice", "", true},
+		{"../escape", "", true},
+	}
+	for _, c := range cases {
+		got, err := CgroupPath(c.parent, "123")
+		if c.fail {
+			if err == nil {
+				t.Errorf("parent %s: expect error", c.parent)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("parent %s: expect %s, got %s %v", c.parent, c.want, got, err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package cgroups
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"minidocker/cgroups/subsystems"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// v2没有阈值通知, 轮询memory.current的间隔
+const thresholdPollInterval = time.Second
+
+// 通过cgroup.event_control注册eventfd通知, 只用于v1
+// 每次触发时向channel发送一次, cgroup被删除后关闭channel
+func registerMemoryEvent(cgroupPath string, file string, arg string) (<-chan struct{}, error) {
+	subsysCgroupPath, err := subsystems.GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	evFile, err := os.Open(path.Join(subsysCgroupPath, file))
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		evFile.Close()
+		return nil, fmt.Errorf("create eventfd error %v", err)
+	}
+	eventfd := os.NewFile(uintptr(fd), "eventfd")
+	data := strings.TrimSpace(fmt.Sprintf("%d %d %s", fd, evFile.Fd(), arg))
+	eventControlPath := path.Join(subsysCgroupPath, "cgroup.event_control")
+	if err := ioutil.WriteFile(eventControlPath, []byte(data), 0700); err != nil {
+		eventfd.Close()
+		evFile.Close()
+		return nil, fmt.Errorf("write %s error %v", eventControlPath, err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			eventfd.Close()
+			evFile.Close()
+		}()
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventfd.Read(buf); err != nil {
+				return
+			}
+			// cgroup被删除时也会触发一次
+			if _, err := os.Stat(eventControlPath); os.IsNotExist(err) {
+				return
+			}
+			if binary.LittleEndian.Uint64(buf) > 0 {
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// 读取v2的memory.events中的计数
+func readMemoryEvents(file string) (map[string]uint64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint64{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, nil
+}
+
+// v2通过inotify监听memory.events的修改, oom计数增加时通知
+func notifyOOMV2(cgroupPath string) (<-chan struct{}, error) {
+	subsysCgroupPath, err := subsystems.GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	eventsFile := path.Join(subsysCgroupPath, "memory.events")
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init error %v", err)
+	}
+	if _, err := unix.InotifyAddWatch(fd, eventsFile, unix.IN_MODIFY); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("inotify watch %s error %v", eventsFile, err)
+	}
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	events, err := readMemoryEvents(eventsFile)
+	if err != nil {
+		inotify.Close()
+		return nil, err
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			inotify.Close()
+		}()
+		lastOOM := events["oom"]
+		buf := make([]byte, unix.SizeofInotifyEvent+unix.PathMax+1)
+		for {
+			n, err := inotify.Read(buf)
+			if err != nil || n < unix.SizeofInotifyEvent {
+				return
+			}
+			// 文件被删除时会收到IN_IGNORED
+			mask := binary.LittleEndian.Uint32(buf[4:8])
+			if mask&unix.IN_IGNORED != 0 {
+				return
+			}
+			events, err := readMemoryEvents(eventsFile)
+			if err != nil {
+				return
+			}
+			if events["oom"] > lastOOM {
+				lastOOM = events["oom"]
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// 容器内存不足触发oom时通知
+func NotifyOOM(cgroupPath string) (<-chan struct{}, error) {
+	if subsystems.IsCgroup2UnifiedMode() {
+		return notifyOOMV2(cgroupPath)
+	}
+	return registerMemoryEvent(cgroupPath, "memory.oom_control", "")
+}
+
+// v2轮询memory.current, 跨过阈值时通知
+func notifyMemoryThresholdV2(cgroupPath string, threshold int64) (<-chan struct{}, error) {
+	subsysCgroupPath, err := subsystems.GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	currentFile := path.Join(subsysCgroupPath, "memory.current")
+	readAbove := func() (bool, error) {
+		content, err := ioutil.ReadFile(currentFile)
+		if err != nil {
+			return false, err
+		}
+		usage, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		return usage >= threshold, err
+	}
+	above, err := readAbove()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for {
+			time.Sleep(thresholdPollInterval)
+			now, err := readAbove()
+			if err != nil {
+				return
+			}
+			if now != above {
+				above = now
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// 内存使用量向上或者向下跨过阈值时通知
+func NotifyMemoryThreshold(cgroupPath string, threshold int64) (<-chan struct{}, error) {
+	if threshold <= 0 {
+		return nil, fmt.Errorf("invalid memory threshold %d", threshold)
+	}
+	if subsystems.IsCgroup2UnifiedMode() {
+		return notifyMemoryThresholdV2(cgroupPath, threshold)
+	}
+	return registerMemoryEvent(cgroupPath, "memory.usage_in_bytes", strconv.FormatInt(threshold, 10))
+}
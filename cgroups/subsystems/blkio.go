@@ -0,0 +1,257 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// 块设备的权重, 设备用主次设备号表示
+type WeightDevice struct {
+	Major  int64  `json:"major"`
+	Minor  int64  `json:"minor"`
+	Weight uint16 `json:"weight"`
+}
+
+// 块设备的bps或者iops限制
+type ThrottleDevice struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Rate  uint64 `json:"rate"`
+}
+
+func (d *ThrottleDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", d.Major, d.Minor, d.Rate)
+}
+
+// 根据设备路径获取主次设备号, 只支持块设备
+func blockDeviceNumber(devicePath string) (int64, int64, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(devicePath, &st); err != nil {
+		return 0, 0, fmt.Errorf("stat device %s error %v", devicePath, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", devicePath)
+	}
+	return int64(unix.Major(uint64(st.Rdev))), int64(unix.Minor(uint64(st.Rdev))), nil
+}
+
+// 校验v1的权重范围[10, 1000], 0表示不设置
+func validateBlkioWeight(weight uint16) error {
+	if weight != 0 && (weight < 10 || weight > 1000) {
+		return fmt.Errorf("blkio weight must be between 10 and 1000, got %d", weight)
+	}
+	return nil
+}
+
+// 解析--blkio-weight
+func ParseBlkioWeight(weight string) (uint16, error) {
+	v, err := strconv.ParseUint(weight, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid blkio weight %s", weight)
+	}
+	if err := validateBlkioWeight(uint16(v)); err != nil {
+		return 0, err
+	}
+	return uint16(v), nil
+}
+
+// 解析--blkio-weight-device, 格式为 /dev/sda:500
+func ParseWeightDevice(weightDevice string) (*WeightDevice, error) {
+	idx := strings.LastIndex(weightDevice, ":")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid weight device %s, expect path:weight", weightDevice)
+	}
+	weight, err := strconv.ParseUint(weightDevice[idx+1:], 10, 16)
+	if err != nil || weight == 0 {
+		return nil, fmt.Errorf("invalid weight device %s", weightDevice)
+	}
+	if err := validateBlkioWeight(uint16(weight)); err != nil {
+		return nil, err
+	}
+	major, minor, err := blockDeviceNumber(weightDevice[:idx])
+	if err != nil {
+		return nil, err
+	}
+	return &WeightDevice{Major: major, Minor: minor, Weight: uint16(weight)}, nil
+}
+
+// 解析--device-read-bps等参数, 格式为 /dev/sda:1mb, iops不支持单位
+func ParseThrottleDevice(throttleDevice string, size bool) (*ThrottleDevice, error) {
+	idx := strings.LastIndex(throttleDevice, ":")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid throttle device %s, expect path:rate", throttleDevice)
+	}
+	var rate uint64
+	if size {
+		v, err := ParseSize(throttleDevice[idx+1:])
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid throttle device %s", throttleDevice)
+		}
+		rate = uint64(v)
+	} else {
+		v, err := strconv.ParseUint(throttleDevice[idx+1:], 10, 64)
+		if err != nil || v == 0 {
+			return nil, fmt.Errorf("invalid throttle device %s", throttleDevice)
+		}
+		rate = v
+	}
+	major, minor, err := blockDeviceNumber(throttleDevice[:idx])
+	if err != nil {
+		return nil, err
+	}
+	return &ThrottleDevice{Major: major, Minor: minor, Rate: rate}, nil
+}
+
+// v1为blkio, v2为io
+type BlkioSubSystem struct {
+	used bool
+}
+
+func (s *BlkioSubSystem) Name() string {
+	return "blkio"
+}
+
+func (s *BlkioSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+		if IsCgroup2UnifiedMode() {
+			err = setIo(subsysCgroupPath, res)
+		} else {
+			err = setBlkio(subsysCgroupPath, res)
+		}
+		if err != nil {
+			return err
+		}
+		// 没有限制时也加入cgroup, 用于统计io
+		s.used = true
+		return nil
+	} else {
+		return err
+	}
+}
+
+// 写入权重, 没有启用CFQ时只有BFQ的权重文件
+func writeWeight(subsysCgroupPath string, files []string, value string) error {
+	for _, file := range files {
+		p := path.Join(subsysCgroupPath, file)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := ioutil.WriteFile(p, []byte(value), 0644); err != nil {
+			return fmt.Errorf("set cgroup %s failed %v", file, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("io weight is not supported by the kernel io scheduler")
+}
+
+func setBlkio(subsysCgroupPath string, res *ResourceConfig) error {
+	if res.BlkioWeight != 0 {
+		if err := writeWeight(subsysCgroupPath, []string{"blkio.weight", "blkio.bfq.weight"},
+			strconv.Itoa(int(res.BlkioWeight))); err != nil {
+			return err
+		}
+	}
+	for _, wd := range res.BlkioWeightDevice {
+		if err := writeWeight(subsysCgroupPath, []string{"blkio.weight_device", "blkio.bfq.weight_device"},
+			fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, wd.Weight)); err != nil {
+			return err
+		}
+	}
+	throttles := []struct {
+		file    string
+		devices []ThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", res.BlkioDeviceReadBps},
+		{"blkio.throttle.write_bps_device", res.BlkioDeviceWriteBps},
+		{"blkio.throttle.read_iops_device", res.BlkioDeviceReadIOps},
+		{"blkio.throttle.write_iops_device", res.BlkioDeviceWriteIOps},
+	}
+	for _, t := range throttles {
+		// 每次写入一个设备
+		for _, d := range t.devices {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, t.file), []byte(d.String()), 0644); err != nil {
+				return fmt.Errorf("set cgroup %s failed %v", t.file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// v1的权重范围是[10, 1000], v2的io.weight范围是[1, 10000]
+func blkioWeightToIoWeight(weight uint16) uint64 {
+	return 1 + (uint64(weight)-10)*9999/990
+}
+
+func setIo(subsysCgroupPath string, res *ResourceConfig) error {
+	if res.BlkioWeight != 0 {
+		weight := blkioWeightToIoWeight(res.BlkioWeight)
+		// io.bfq.weight与v1一样使用[1, 1000]的范围
+		if _, err := os.Stat(path.Join(subsysCgroupPath, "io.weight")); err == nil {
+			if err := writeWeight(subsysCgroupPath, []string{"io.weight"}, fmt.Sprintf("default %d", weight)); err != nil {
+				return err
+			}
+		} else if err := writeWeight(subsysCgroupPath, []string{"io.bfq.weight"}, strconv.Itoa(int(res.BlkioWeight))); err != nil {
+			return err
+		}
+	}
+	for _, wd := range res.BlkioWeightDevice {
+		if err := writeWeight(subsysCgroupPath, []string{"io.weight"},
+			fmt.Sprintf("%d:%d %d", wd.Major, wd.Minor, blkioWeightToIoWeight(wd.Weight))); err != nil {
+			return err
+		}
+	}
+	// io.max中每个设备一行, 同一个设备的限制可以一起写入
+	limits := map[string][]string{}
+	var order []string
+	add := func(key string, devices []ThrottleDevice) {
+		for _, d := range devices {
+			dev := fmt.Sprintf("%d:%d", d.Major, d.Minor)
+			if _, ok := limits[dev]; !ok {
+				order = append(order, dev)
+			}
+			limits[dev] = append(limits[dev], fmt.Sprintf("%s=%d", key, d.Rate))
+		}
+	}
+	add("rbps", res.BlkioDeviceReadBps)
+	add("wbps", res.BlkioDeviceWriteBps)
+	add("riops", res.BlkioDeviceReadIOps)
+	add("wiops", res.BlkioDeviceWriteIOps)
+	for _, dev := range order {
+		line := dev + " " + strings.Join(limits[dev], " ")
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "io.max"), []byte(line), 0644); err != nil {
+			return fmt.Errorf("set cgroup io.max failed %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *BlkioSubSystem) Remove(cgroupPath string) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+			return os.RemoveAll(subsysCgroupPath)
+		} else {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BlkioSubSystem) Apply(cgroupPath string, pid int) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile),
+				[]byte(strconv.Itoa(pid)), 0644); err != nil {
+				return fmt.Errorf("set cgroup %s proc failed %v", s.Name(), err)
+			}
+		} else {
+			return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+		}
+	}
+	return nil
+}
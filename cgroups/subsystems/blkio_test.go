@@ -0,0 +1,20 @@
+package subsystems
+
+import "testing"
+
+func TestParseThrottleDevice(t *testing.T) {
+	for _, td := range []string{"/dev/null:1mb", "/dev/sda", ":100", "/nonexistent:100"} {
+		if _, err := ParseThrottleDevice(td, true); err == nil {
+			t.Errorf("throttle device %s: expect error", td)
+		}
+	}
+}
+
+func TestBlkioWeightToIoWeight(t *testing.T) {
+	cases := map[uint16]uint64{10: 1, 500: 4950, 1000: 10000}
+	for weight, want := range cases {
+		if got := blkioWeightToIoWeight(weight); got != want {
+			t.Errorf("weight %d: expect %d, got %d", weight, want, got)
+		}
+	}
+}
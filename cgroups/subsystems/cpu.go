@@ -8,6 +8,9 @@ import (
 	"strconv"
 )
 
+// 内核默认的CFS调度周期, 单位微秒
+const DefaultCpuPeriod int64 = 100000
+
 type CpuSubSystem struct {
 	used bool
 }
@@ -19,18 +22,107 @@ func (s *CpuSubSystem) Name() string {
 func (s *CpuSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
 		if res.CpuShare != "" {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpu.shares"),
-				[]byte(res.CpuShare), 0644); err != nil {
+			fileName, value := "cpu.shares", res.CpuShare
+			if IsCgroup2UnifiedMode() {
+				// v2没有cpu.shares, 换算为cpu.weight
+				weight, err := sharesToWeight(res.CpuShare)
+				if err != nil {
+					return err
+				}
+				fileName, value = "cpu.weight", weight
+			}
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, fileName),
+				[]byte(value), 0644); err != nil {
 				return fmt.Errorf("set cgroup cpu share fail %v", err)
 			}
 			s.used = true
 		}
+		if res.CpuQuota != 0 || res.CpuPeriod != 0 {
+			if err := setCpuQuota(subsysCgroupPath, res.CpuQuota, res.CpuPeriod); err != nil {
+				return err
+			}
+			s.used = true
+		}
 		return nil
 	} else {
 		return err
 	}
 }
 
+// v1写入cpu.cfs_period_us和cpu.cfs_quota_us, v2写入cpu.max
+// quota为-1表示不限制, period为0表示使用默认值
+func setCpuQuota(subsysCgroupPath string, quota int64, period int64) error {
+	if IsCgroup2UnifiedMode() {
+		if period == 0 {
+			period = DefaultCpuPeriod
+		}
+		max := "max"
+		if quota > 0 {
+			max = strconv.FormatInt(quota, 10)
+		}
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpu.max"),
+			[]byte(fmt.Sprintf("%s %d", max, period)), 0644); err != nil {
+			return fmt.Errorf("set cgroup cpu max fail %v", err)
+		}
+		return nil
+	}
+	if period != 0 {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_period_us"),
+			[]byte(strconv.FormatInt(period, 10)), 0644); err != nil {
+			return fmt.Errorf("set cgroup cpu period fail %v", err)
+		}
+	}
+	if quota != 0 {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpu.cfs_quota_us"),
+			[]byte(strconv.FormatInt(quota, 10)), 0644); err != nil {
+			return fmt.Errorf("set cgroup cpu quota fail %v", err)
+		}
+	}
+	return nil
+}
+
+// 校验--cpu-quota和--cpu-period, 内核要求period在[1ms, 1s]之间, quota不小于1ms
+func ValidateCpuQuota(quota int64, period int64) error {
+	if period != 0 && (period < 1000 || period > 1000000) {
+		return fmt.Errorf("cpu period must be between 1000 and 1000000, got %d", period)
+	}
+	if quota != 0 && quota != -1 && quota < 1000 {
+		return fmt.Errorf("cpu quota must be -1 or at least 1000, got %d", quota)
+	}
+	return nil
+}
+
+// 将--cpus换算为quota, 如 1.5 在默认period下为 150000
+func CpusToQuota(cpus string, period int64) (int64, error) {
+	v, err := strconv.ParseFloat(cpus, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid cpus %s", cpus)
+	}
+	if period == 0 {
+		period = DefaultCpuPeriod
+	}
+	quota := int64(v*float64(period) + 0.5)
+	if quota < 1000 {
+		return 0, fmt.Errorf("cpus %s is too small", cpus)
+	}
+	return quota, nil
+}
+
+// cpu.shares的范围是[2, 262144], cpu.weight的范围是[1, 10000]
+func sharesToWeight(shares string) (string, error) {
+	v, err := strconv.ParseUint(shares, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid cpu share %s", shares)
+	}
+	if v < 2 {
+		v = 2
+	}
+	if v > 262144 {
+		v = 262144
+	}
+	return strconv.FormatUint(1+((v-2)*9999)/262142, 10), nil
+}
+
 func (s *CpuSubSystem) Remove(cgroupPath string) error {
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
 		return os.RemoveAll(subsysCgroupPath)
@@ -41,7 +133,7 @@ func (s *CpuSubSystem) Remove(cgroupPath string) error {
 func (s *CpuSubSystem) Apply(cgroupPath string, pid int) error {
 	if s.used {
 		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "tasks"),
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile),
 				[]byte(strconv.Itoa(pid)), 0644); err != nil {
 				return fmt.Errorf("set cgroup %s proc fail %v", s.Name(), err)
 			}
@@ -0,0 +1,40 @@
+package subsystems
+
+import "testing"
+
+func TestCpusToQuota(t *testing.T) {
+	cases := []struct {
+		cpus   string
+		period int64
+		quota  int64
+		fail   bool
+	}{
+		{"1.5", 0, 150000, false},
+		{"0.5", 50000, 25000, false},
+		{"2", 1000000, 2000000, false},
+		{"0.001", 0, 0, true},
+		{"-1", 0, 0, true},
+		{"abc", 0, 0, true},
+	}
+	for _, c := range cases {
+		quota, err := CpusToQuota(c.cpus, c.period)
+		if c.fail {
+			if err == nil {
+				t.Errorf("cpus %s: expect error", c.cpus)
+			}
+			continue
+		}
+		if err != nil || quota != c.quota {
+			t.Errorf("cpus %s period %d: expect %d, got %d %v", c.cpus, c.period, c.quota, quota, err)
+		}
+	}
+}
+
+func TestSharesToWeight(t *testing.T) {
+	cases := map[string]string{"2": "1", "1024": "39", "262144": "10000"}
+	for shares, weight := range cases {
+		if got, err := sharesToWeight(shares); err != nil || got != weight {
+			t.Errorf("shares %s: expect %s, got %s %v", shares, weight, got, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+)
+
+// 只用于统计cpu使用时间, 不做限制
+// v2的cpu.stat在每个cgroup中都存在, 不需要单独加入
+type CpuacctSubSystem struct {
+	used bool
+}
+
+func (s *CpuacctSubSystem) Name() string {
+	return "cpuacct"
+}
+
+func (s *CpuacctSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if IsCgroup2UnifiedMode() {
+		return nil
+	}
+	if _, err := GetCgroupPath(s.Name(), cgroupPath, true); err != nil {
+		return err
+	}
+	s.used = true
+	return nil
+}
+
+func (s *CpuacctSubSystem) Remove(cgroupPath string) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+			return os.RemoveAll(subsysCgroupPath)
+		} else {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CpuacctSubSystem) Apply(cgroupPath string, pid int) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile),
+				[]byte(strconv.Itoa(pid)), 0644); err != nil {
+				return fmt.Errorf("set cgroup %s proc failed %v", s.Name(), err)
+			}
+		} else {
+			return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+		}
+	}
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 type CpusetSubSystem struct {
@@ -18,7 +20,12 @@ func (s *CpusetSubSystem) Name() string {
 
 func (s *CpusetSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
-		if res.CpuShare != "" {
+		if res.CpuSet != "" {
+			if !IsCgroup2UnifiedMode() {
+				if err := initCpuset(subsysCgroupPath); err != nil {
+					return fmt.Errorf("init cgroup cpuset fail %v", err)
+				}
+			}
 			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"),
 				[]byte(res.CpuSet), 0644); err != nil {
 				return fmt.Errorf("set cgroup cpuset fail %v", err)
@@ -31,6 +38,37 @@ func (s *CpusetSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
 	}
 }
 
+// v1新建的cpuset cgroup中cpus和mems为空, 此时无法加入进程
+// 需要先从父cgroup继承, 父cgroup也为空时递归初始化
+func initCpuset(dir string) error {
+	parent := filepath.Dir(dir)
+	for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+		content, err := ioutil.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(content)) != "" {
+			continue
+		}
+		parentContent, err := ioutil.ReadFile(path.Join(parent, file))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(parentContent)) == "" {
+			if err := initCpuset(parent); err != nil {
+				return err
+			}
+			if parentContent, err = ioutil.ReadFile(path.Join(parent, file)); err != nil {
+				return err
+			}
+		}
+		if err := ioutil.WriteFile(path.Join(dir, file), parentContent, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *CpusetSubSystem) Remove(cgroupPath string) error {
 	if s.used {
 		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
@@ -43,7 +81,7 @@ func (s *CpusetSubSystem) Remove(cgroupPath string) error {
 func (s *CpusetSubSystem) Apply(cgroupPath string, pid int) error {
 	if s.used {
 		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "tasks"),
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile),
 				[]byte(strconv.Itoa(pid)), 0644); err != nil {
 				return fmt.Errorf("set cgroup %s proc fail %v", s.Name(), err)
 			}
@@ -0,0 +1,46 @@
+package subsystems
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestInitCpuset(t *testing.T) {
+	root, err := ioutil.TempDir("", "cpuset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	child := path.Join(root, "parent", "child")
+	if err := os.MkdirAll(child, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"cpuset.cpus":              "0-3\n",
+		"cpuset.mems":              "0\n",
+		"parent/cpuset.cpus":       "",
+		"parent/cpuset.mems":       "",
+		"parent/child/cpuset.cpus": "1\n",
+		"parent/child/cpuset.mems": "",
+	}
+	for name, content := range files {
+		ioutil.WriteFile(path.Join(root, name), []byte(content), 0644)
+	}
+	if err := initCpuset(child); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"parent/cpuset.cpus":       "0-3\n",
+		"parent/cpuset.mems":       "0\n",
+		"parent/child/cpuset.cpus": "1\n",
+		"parent/child/cpuset.mems": "0\n",
+	}
+	for name, want := range expect {
+		got, _ := ioutil.ReadFile(path.Join(root, name))
+		if string(got) != want {
+			t.Errorf("%s: expect %q, got %q", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 默认允许容器访问的设备
+var defaultAllowedDevices = []string{
+	// 允许mknod任意设备, 但是读写仍然受限
+	"c *:* m",
+	"b *:* m",
+	"c 1:3 rwm",   // /dev/null
+	"c 1:5 rwm",   // /dev/zero
+	"c 1:7 rwm",   // /dev/full
+	"c 1:8 rwm",   // /dev/random
+	"c 1:9 rwm",   // /dev/urandom
+	"c 5:0 rwm",   // /dev/tty
+	"c 5:1 rwm",   // /dev/console
+	"c 5:2 rwm",   // /dev/ptmx
+	"c 136:* rwm", // /dev/pts/*
+}
+
+type DevicesSubSystem struct {
+	used bool
+}
+
+func (s *DevicesSubSystem) Name() string {
+	return "devices"
+}
+
+// 先禁止所有设备, 再按白名单放开
+// v2的设备控制需要通过eBPF实现, 暂不支持
+func (s *DevicesSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if IsCgroup2UnifiedMode() {
+		logrus.Warnf("devices cgroup is not supported on cgroup v2, skip device policy")
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "devices.deny"),
+			[]byte("a"), 0644); err != nil {
+			return fmt.Errorf("set cgroup devices deny fail %v", err)
+		}
+		allowed := append([]string{}, defaultAllowedDevices...)
+		allowed = append(allowed, res.Devices...)
+		for _, rule := range allowed {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "devices.allow"),
+				[]byte(rule), 0644); err != nil {
+				return fmt.Errorf("set cgroup devices allow %s fail %v", rule, err)
+			}
+		}
+		s.used = true
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (s *DevicesSubSystem) Remove(cgroupPath string) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+			return os.RemoveAll(subsysCgroupPath)
+		}
+	}
+	return nil
+}
+
+func (s *DevicesSubSystem) Apply(cgroupPath string, pid int) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile),
+				[]byte(strconv.Itoa(pid)), 0644); err != nil {
+				return fmt.Errorf("set cgroup %s proc fail %v", s.Name(), err)
+			}
+		} else {
+			return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+		}
+	}
+	return nil
+}
@@ -1,13 +1,20 @@
 package subsystems
 
 import (
+	"bufio"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
 )
 
+// 内核允许的最小内存限制
+const minMemoryLimit = 6 << 20
+
 type MemorySubSystem struct {
 	used bool
 }
@@ -16,21 +23,159 @@ func (s *MemorySubSystem) Name() string {
 	return "memory"
 }
 
+// 校验内存相关的参数, swap为内存和swap的总和, -1表示不限制swap
+func ValidateMemory(res *ResourceConfig) error {
+	if res.MemoryLimit != 0 && res.MemoryLimit < minMemoryLimit {
+		return fmt.Errorf("minimum memory limit allowed is 6MB")
+	}
+	if res.MemorySwap != 0 {
+		if res.MemoryLimit == 0 {
+			return fmt.Errorf("memory-swap requires memory to be set")
+		}
+		if res.MemorySwap != -1 && res.MemorySwap < res.MemoryLimit {
+			return fmt.Errorf("memory-swap must be larger than memory")
+		}
+	}
+	if res.MemoryReservation != 0 && res.MemoryLimit != 0 && res.MemoryReservation > res.MemoryLimit {
+		return fmt.Errorf("memory-reservation must be smaller than memory")
+	}
+	if res.MemorySwappiness != nil && (*res.MemorySwappiness < 0 || *res.MemorySwappiness > 100) {
+		return fmt.Errorf("memory-swappiness must be between 0 and 100, got %d", *res.MemorySwappiness)
+	}
+	return nil
+}
+
 func (s *MemorySubSystem) Set(cgroupPath string, res *ResourceConfig) error {
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
-		if res.MemoryLimit != "" {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "memory.limit_in_bytes"),
-				[]byte(res.MemoryLimit), 0644); err != nil {
-				return fmt.Errorf("set cgroup memory failed %v", err)
-			}
-		  s.used = true
+		if IsCgroup2UnifiedMode() {
+			err = setMemoryV2(subsysCgroupPath, res)
+		} else {
+			err = setMemoryV1(subsysCgroupPath, res)
 		}
+		if err != nil {
+			return err
+		}
+		// 没有限制时也加入cgroup, 用于统计内存使用和oom
+		s.used = true
 		return nil
 	} else {
 		return err
 	}
 }
 
+func writeMemoryFile(subsysCgroupPath string, file string, value string) error {
+	if err := ioutil.WriteFile(path.Join(subsysCgroupPath, file), []byte(value), 0644); err != nil {
+		return fmt.Errorf("set cgroup %s failed %v", file, err)
+	}
+	return nil
+}
+
+func setMemoryV1(subsysCgroupPath string, res *ResourceConfig) error {
+	if res.MemoryLimit != 0 {
+		// memsw.limit_in_bytes不能小于limit_in_bytes, 调大时需要先设置memsw
+		swapFirst := false
+		if content, err := ioutil.ReadFile(path.Join(subsysCgroupPath, "memory.limit_in_bytes")); err == nil {
+			current, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+			swapFirst = err == nil && res.MemoryLimit > current
+		}
+		if swapFirst && res.MemorySwap != 0 {
+			if err := setMemsw(subsysCgroupPath, res.MemorySwap); err != nil {
+				return err
+			}
+		}
+		if err := writeMemoryFile(subsysCgroupPath, "memory.limit_in_bytes", strconv.FormatInt(res.MemoryLimit, 10)); err != nil {
+			return err
+		}
+		if !swapFirst && res.MemorySwap != 0 {
+			if err := setMemsw(subsysCgroupPath, res.MemorySwap); err != nil {
+				return err
+			}
+		}
+	}
+	if res.MemoryReservation != 0 {
+		if err := writeMemoryFile(subsysCgroupPath, "memory.soft_limit_in_bytes", strconv.FormatInt(res.MemoryReservation, 10)); err != nil {
+			return err
+		}
+	}
+	if res.OomKillDisable {
+		if err := writeMemoryFile(subsysCgroupPath, "memory.oom_control", "1"); err != nil {
+			return err
+		}
+	}
+	if res.MemorySwappiness != nil {
+		if err := writeMemoryFile(subsysCgroupPath, "memory.swappiness", strconv.FormatInt(*res.MemorySwappiness, 10)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 没有开启swap记账时不存在memsw文件
+func setMemsw(subsysCgroupPath string, swap int64) error {
+	if _, err := os.Stat(path.Join(subsysCgroupPath, "memory.memsw.limit_in_bytes")); err != nil {
+		logrus.Warnf("swap limit is not supported by the kernel, memory-swap is ignored")
+		return nil
+	}
+	return writeMemoryFile(subsysCgroupPath, "memory.memsw.limit_in_bytes", strconv.FormatInt(swap, 10))
+}
+
+func setMemoryV2(subsysCgroupPath string, res *ResourceConfig) error {
+	if res.MemoryLimit != 0 {
+		if err := writeMemoryFile(subsysCgroupPath, "memory.max", strconv.FormatInt(res.MemoryLimit, 10)); err != nil {
+			return err
+		}
+	}
+	// v2的memory.swap.max只包含swap, 不包含内存
+	if res.MemorySwap != 0 {
+		swap := "max"
+		if res.MemorySwap > 0 {
+			swap = strconv.FormatInt(res.MemorySwap-res.MemoryLimit, 10)
+		}
+		if err := writeMemoryFile(subsysCgroupPath, "memory.swap.max", swap); err != nil {
+			return err
+		}
+	}
+	if res.MemoryReservation != 0 {
+		if err := writeMemoryFile(subsysCgroupPath, "memory.low", strconv.FormatInt(res.MemoryReservation, 10)); err != nil {
+			return err
+		}
+	}
+	if res.OomKillDisable {
+		logrus.Warnf("cgroup v2 does not support disabling oom killer, oom-kill-disable is ignored")
+	}
+	if res.MemorySwappiness != nil {
+		logrus.Warnf("cgroup v2 does not support memory swappiness, memory-swappiness is ignored")
+	}
+	return nil
+}
+
+// 读取cgroup中被oom killer杀死的进程数
+// v1在memory.oom_control中, v2在memory.events中
+func GetOOMKillCount(cgroupPath string) (uint64, error) {
+	subsysCgroupPath, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	file := "memory.oom_control"
+	if IsCgroup2UnifiedMode() {
+		file = "memory.events"
+	}
+	f, err := os.Open(path.Join(subsysCgroupPath, file))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
+
 func (s *MemorySubSystem) Remove(cgroupPath string) error {
 	if s.used {
 		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
@@ -45,7 +190,7 @@ func (s *MemorySubSystem) Remove(cgroupPath string) error {
 func (s *MemorySubSystem) Apply(cgroupPath string, pid int) error {
 	if s.used {
 		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "tasks"),
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile),
 				[]byte(strconv.Itoa(pid)), 0644); err != nil {
 				return fmt.Errorf("set cgroup %s proc failed %v", s.Name(), err)
 			}
@@ -0,0 +1,25 @@
+package subsystems
+
+import "testing"
+
+func TestValidateMemory(t *testing.T) {
+	swappiness := int64(101)
+	cases := []struct {
+		res  ResourceConfig
+		fail bool
+	}{
+		{ResourceConfig{MemoryLimit: 100 << 20}, false},
+		{ResourceConfig{MemoryLimit: 100 << 20, MemorySwap: -1}, false},
+		{ResourceConfig{MemoryLimit: 100 << 20, MemorySwap: 200 << 20, MemoryReservation: 50 << 20}, false},
+		{ResourceConfig{MemoryLimit: 1 << 20}, true},
+		{ResourceConfig{MemorySwap: 200 << 20}, true},
+		{ResourceConfig{MemoryLimit: 100 << 20, MemorySwap: 50 << 20}, true},
+		{ResourceConfig{MemoryLimit: 100 << 20, MemoryReservation: 200 << 20}, true},
+		{ResourceConfig{MemorySwappiness: &swappiness}, true},
+	}
+	for i, c := range cases {
+		if err := ValidateMemory(&c.res); (err != nil) != c.fail {
+			t.Errorf("case %d: expect fail %v, got %v", i, c.fail, err)
+		}
+	}
+}
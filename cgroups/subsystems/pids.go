@@ -0,0 +1,102 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type PidsSubSystem struct {
+	used bool
+}
+
+func (s *PidsSubSystem) Name() string {
+	return "pids"
+}
+
+func (s *PidsSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+		if res.PidsLimit != 0 {
+			// -1或者负数表示不限制
+			limit := "max"
+			if res.PidsLimit > 0 {
+				limit = strconv.FormatInt(res.PidsLimit, 10)
+			}
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "pids.max"),
+				[]byte(limit), 0644); err != nil {
+				return fmt.Errorf("set cgroup pids failed %v", err)
+			}
+		}
+		// 没有限制时也加入cgroup, 用于统计进程数
+		s.used = true
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (s *PidsSubSystem) Remove(cgroupPath string) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+			return os.RemoveAll(subsysCgroupPath)
+		} else {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PidsSubSystem) Apply(cgroupPath string, pid int) error {
+	if s.used {
+		if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile),
+				[]byte(strconv.Itoa(pid)), 0644); err != nil {
+				return fmt.Errorf("set cgroup %s proc failed %v", s.Name(), err)
+			}
+		} else {
+			return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+		}
+	}
+	return nil
+}
+
+// 读取cgroup中当前的进程数
+func GetPidsCurrent(cgroupPath string) (uint64, error) {
+	subsysCgroupPath, err := GetCgroupPath("pids", cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	content, err := ioutil.ReadFile(path.Join(subsysCgroupPath, "pids.current"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// 读取cgroup中的所有进程, v1依次尝试总是会加入的subsystem
+func GetPids(cgroupPath string) ([]int, error) {
+	var lastErr error
+	for _, subsystem := range []string{"pids", "memory", "cpuacct"} {
+		subsysCgroupPath, err := GetCgroupPath(subsystem, cgroupPath, false)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		content, err := ioutil.ReadFile(path.Join(subsysCgroupPath, procsFile))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var pids []int
+		for _, line := range strings.Fields(string(content)) {
+			if pid, err := strconv.Atoi(line); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+		return pids, nil
+	}
+	return nil, lastErr
+}
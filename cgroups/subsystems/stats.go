@@ -0,0 +1,164 @@
+package subsystems
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// cgroup的资源使用情况
+type Stats struct {
+	// cpu累计使用时间, 单位纳秒
+	CpuUsage uint64 `json:"cpuUsage"`
+	// 内存使用量, 不包含可回收的page cache
+	MemoryUsage uint64 `json:"memoryUsage"`
+	MemoryLimit uint64 `json:"memoryLimit"`
+	Pids        uint64 `json:"pids"`
+	BlkioRead   uint64 `json:"blkioRead"`
+	BlkioWrite  uint64 `json:"blkioWrite"`
+}
+
+func readUint(file string) (uint64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	// v2中没有限制时为max
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// 读取"key value"格式的文件, 如memory.stat和cpu.stat
+func readKeyValues(file string) (map[string]uint64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+func getCpuUsage(cgroupPath string) (uint64, error) {
+	if IsCgroup2UnifiedMode() {
+		subsysCgroupPath, err := GetCgroupPath("cpu", cgroupPath, false)
+		if err != nil {
+			return 0, err
+		}
+		values, err := readKeyValues(path.Join(subsysCgroupPath, "cpu.stat"))
+		if err != nil {
+			return 0, err
+		}
+		return values["usage_usec"] * 1000, nil
+	}
+	subsysCgroupPath, err := GetCgroupPath("cpuacct", cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	return readUint(path.Join(subsysCgroupPath, "cpuacct.usage"))
+}
+
+func getMemoryUsage(cgroupPath string) (uint64, uint64, error) {
+	subsysCgroupPath, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	usageFile, limitFile, inactiveKey := "memory.usage_in_bytes", "memory.limit_in_bytes", "total_inactive_file"
+	if IsCgroup2UnifiedMode() {
+		usageFile, limitFile, inactiveKey = "memory.current", "memory.max", "inactive_file"
+	}
+	usage, err := readUint(path.Join(subsysCgroupPath, usageFile))
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err := readUint(path.Join(subsysCgroupPath, limitFile))
+	if err != nil {
+		return 0, 0, err
+	}
+	// 与常见容器运行时一致, 去掉不活跃的文件缓存
+	if values, err := readKeyValues(path.Join(subsysCgroupPath, "memory.stat")); err == nil {
+		if inactive := values[inactiveKey]; inactive < usage {
+			usage -= inactive
+		}
+	}
+	return usage, limit, nil
+}
+
+// v1读取blkio.throttle.io_service_bytes_recursive, v2读取io.stat
+func getBlkioUsage(cgroupPath string) (uint64, uint64, error) {
+	subsysCgroupPath, err := GetCgroupPath("blkio", cgroupPath, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	file := "blkio.throttle.io_service_bytes_recursive"
+	if IsCgroup2UnifiedMode() {
+		file = "io.stat"
+	}
+	f, err := os.Open(path.Join(subsysCgroupPath, file))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var read, write uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if IsCgroup2UnifiedMode() {
+			// 8:0 rbytes=1 wbytes=2 rios=3 wios=4 ...
+			for _, field := range fields[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v, _ := strconv.ParseUint(kv[1], 10, 64)
+				switch kv[0] {
+				case "rbytes":
+					read += v
+				case "wbytes":
+					write += v
+				}
+			}
+			continue
+		}
+		// 8:0 Read 1
+		if len(fields) != 3 {
+			continue
+		}
+		v, _ := strconv.ParseUint(fields[2], 10, 64)
+		switch fields[1] {
+		case "Read":
+			read += v
+		case "Write":
+			write += v
+		}
+	}
+	return read, write, scanner.Err()
+}
+
+// 读取容器cgroup的资源使用情况, 读取失败的项为0
+func GetStats(cgroupPath string) *Stats {
+	stats := &Stats{}
+	stats.CpuUsage, _ = getCpuUsage(cgroupPath)
+	stats.MemoryUsage, stats.MemoryLimit, _ = getMemoryUsage(cgroupPath)
+	stats.Pids, _ = GetPidsCurrent(cgroupPath)
+	stats.BlkioRead, stats.BlkioWrite, _ = getBlkioUsage(cgroupPath)
+	return stats
+}
@@ -1,10 +1,31 @@
 package subsystems
 
-// Memory limit, cpu weight, cpu core num
+// Memory limit, cpu weight, cpu quota, cpu core num, allowed devices, pids limit, block io
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuShare    string
-	CpuSet      string
+	// 内存限制, 单位字节
+	MemoryLimit int64 `json:"memoryLimit"`
+	// 内存和swap的总和, -1表示不限制swap
+	MemorySwap        int64 `json:"memorySwap"`
+	MemoryReservation int64 `json:"memoryReservation"`
+	OomKillDisable    bool  `json:"oomKillDisable"`
+	// 未设置时为nil
+	MemorySwappiness *int64 `json:"memorySwappiness"`
+	CpuShare         string `json:"cpuShare"`
+	CpuSet           string `json:"cpuSet"`
+	// CFS调度的quota和period, 单位微秒, quota为-1表示不限制
+	CpuQuota  int64 `json:"cpuQuota"`
+	CpuPeriod int64 `json:"cpuPeriod"`
+	// 最大进程数, -1表示不限制
+	PidsLimit int64 `json:"pidsLimit"`
+	// 块设备io的权重和限制
+	BlkioWeight          uint16           `json:"blkioWeight"`
+	BlkioWeightDevice    []WeightDevice   `json:"blkioWeightDevice"`
+	BlkioDeviceReadBps   []ThrottleDevice `json:"blkioDeviceReadBps"`
+	BlkioDeviceWriteBps  []ThrottleDevice `json:"blkioDeviceWriteBps"`
+	BlkioDeviceReadIOps  []ThrottleDevice `json:"blkioDeviceReadIOps"`
+	BlkioDeviceWriteIOps []ThrottleDevice `json:"blkioDeviceWriteIOps"`
+	// 额外允许访问的设备, 如 "c 10:200 rwm"
+	Devices []string `json:"devices"`
 }
 
 type Subsystem interface {
@@ -14,16 +35,29 @@ type Subsystem interface {
 	Remove(path string) error
 }
 
-var (
-	SubsystemsIns = []Subsystem{
+// 每个容器使用独立的subsystem实例, 避免used状态在容器之间共享
+func NewSubsystems() []Subsystem {
+	return []Subsystem{
 		&CpusetSubSystem{
-      used: false,
-    },
+			used: false,
+		},
 		&MemorySubSystem{
-      used: false,
-    },
+			used: false,
+		},
 		&CpuSubSystem{
-      used: false,
-    },
+			used: false,
+		},
+		&CpuacctSubSystem{
+			used: false,
+		},
+		&DevicesSubSystem{
+			used: false,
+		},
+		&PidsSubSystem{
+			used: false,
+		},
+		&BlkioSubSystem{
+			used: false,
+		},
 	}
-)
+}
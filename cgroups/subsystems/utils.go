@@ -5,44 +5,129 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const unifiedMountpoint = "/sys/fs/cgroup"
+
+var (
+	isUnifiedOnce sync.Once
+	isUnified     bool
 )
 
+// 判断宿主机是否只挂载了cgroup v2(unified hierarchy)
+func IsCgroup2UnifiedMode() bool {
+	isUnifiedOnce.Do(func() {
+		var st unix.Statfs_t
+		if err := unix.Statfs(unifiedMountpoint, &st); err == nil {
+			isUnified = st.Type == unix.CGROUP2_SUPER_MAGIC
+		}
+	})
+	return isUnified
+}
+
+// 找到cgroup v2的挂载点
+func FindCgroup2MountPoint() string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return unifiedMountpoint
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 分隔符" - "之后的第一个字段是文件系统类型
+		txt := scanner.Text()
+		parts := strings.SplitN(txt, " - ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if strings.HasPrefix(parts[1], "cgroup2 ") {
+			return strings.Split(parts[0], " ")[4]
+		}
+	}
+	return unifiedMountpoint
+}
+
 func FindCgroupMountPoint(subsystem string) string {
-  f, err := os.Open("/proc/self/mountinfo")
-  if err != nil {
-    return ""
-  }
-  defer f.Close()
-
-  scanner := bufio.NewScanner(f)
-  for scanner.Scan() {
-    txt := scanner.Text()
-    fields := strings.Split(txt, " ")
-    for _, opt := range strings.Split(fields[len(fields)-1], ",") {
-      if opt == subsystem {
-        return fields[4]
-      }
-    }
-  }
-  if err := scanner.Err(); err != nil {
-    return ""
-  }
-  return ""
+	// v2所有的controller都在同一个挂载点下
+	if IsCgroup2UnifiedMode() {
+		return FindCgroup2MountPoint()
+	}
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		txt := scanner.Text()
+		fields := strings.Split(txt, " ")
+		for _, opt := range strings.Split(fields[len(fields)-1], ",") {
+			if opt == subsystem {
+				return fields[4]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return ""
+	}
+	return ""
 }
 
 func GetCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string, error) {
-  cgroupRoot := FindCgroupMountPoint(subsystem)
-
-  if _,err := os.Stat(path.Join(cgroupRoot, cgroupPath)); err == nil || (autoCreate && os.IsNotExist(err)) {
-    if os.IsNotExist(err) {
-      if err := os.Mkdir(path.Join(cgroupRoot, cgroupPath), 0755); err == nil {
-      } else {
-        return "", fmt.Errorf("error create cgroup %v", err)
-      }
-    }
-    return path.Join(cgroupRoot, cgroupPath), nil
-  } else {
-    return "", fmt.Errorf("cgroup path error %v", err)
-  }
+	cgroupRoot := FindCgroupMountPoint(subsystem)
+
+	if _, err := os.Stat(path.Join(cgroupRoot, cgroupPath)); err == nil || (autoCreate && os.IsNotExist(err)) {
+		if os.IsNotExist(err) {
+			// cgroupPath可能包含多级父目录
+			if err := os.MkdirAll(path.Join(cgroupRoot, cgroupPath), 0755); err == nil {
+			} else {
+				return "", fmt.Errorf("error create cgroup %v", err)
+			}
+		}
+		return path.Join(cgroupRoot, cgroupPath), nil
+	} else {
+		return "", fmt.Errorf("cgroup path error %v", err)
+	}
+}
+
+// 加入cgroup时写入的文件, v1和v2都使用cgroup.procs
+// v1的tasks只移动单个线程, 写入cgroup.procs会移动进程的所有线程
+const procsFile = "cgroup.procs"
+
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// 解析带单位的大小, 如 512, 100k, 1.5m, 2gb, 单位按1024换算
+func ParseSize(size string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(size))
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	unit := strings.TrimSuffix(s[i:], "b")
+	if s[i:] == "b" {
+		unit = "b"
+	}
+	multiplier, ok := sizeUnits[unit]
+	if i == 0 || !ok {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	return int64(v * float64(multiplier)), nil
 }
@@ -0,0 +1,25 @@
+package subsystems
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"512":   512,
+		"1b":    1,
+		"100k":  100 << 10,
+		"100KB": 100 << 10,
+		"1.5m":  3 << 19,
+		"2g":    2 << 30,
+		"1t":    1 << 40,
+	}
+	for size, want := range cases {
+		if got, err := ParseSize(size); err != nil || got != want {
+			t.Errorf("size %s: expect %d, got %d %v", size, want, got, err)
+		}
+	}
+	for _, size := range []string{"", "m", "1x", "1.2.3k", "-1"} {
+		if _, err := ParseSize(size); err == nil {
+			t.Errorf("size %s: expect error", size)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package command
 
 import (
 	"fmt"
+	"minidocker/cgroups"
 	"minidocker/cgroups/subsystems"
 	"minidocker/container"
 	"minidocker/network"
+	"net"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -14,14 +16,22 @@ import (
 var InitCommand = cli.Command{
 	Name:  "init",
 	Usage: "init container process run user's process in container. Do not call it outside",
-	Action: func(_ *cli.Context) error {
-		if err := container.RunContainerInitProcess(); err != nil {
+	Action: func(context *cli.Context) error {
+		if err := container.RunContainerInitProcess(context.Args().Get(0)); err != nil {
 			logrus.Infof("init failed!")
 		}
 		return nil
 	},
 }
 
+var MonitorCommand = cli.Command{
+	Name:  "monitor",
+	Usage: "monitor cgroup events of a container. Do not call it outside",
+	Action: func(context *cli.Context) error {
+		return monitorContainer(context.Args().Get(0))
+	},
+}
+
 var RunCommand = cli.Command{
 	Name:  "run",
 	Usage: "create a container with namespace and cgroups limit. minidocker run -it [command]",
@@ -40,12 +50,76 @@ var RunCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "m",
-			Usage: "memory limit",
+			Usage: "memory limit, e.g. 100m",
+		},
+		cli.StringFlag{
+			Name:  "memory-swap",
+			Usage: "memory plus swap limit, -1 for unlimited swap",
+		},
+		cli.StringFlag{
+			Name:  "memory-reservation",
+			Usage: "memory soft limit",
+		},
+		cli.BoolFlag{
+			Name:  "oom-kill-disable",
+			Usage: "disable oom killer",
+		},
+		cli.Int64Flag{
+			Name:  "memory-swappiness",
+			Usage: "tune memory swappiness, between 0 and 100",
 		},
 		cli.StringFlag{
 			Name:  "cpushare",
 			Usage: "cpushare limit",
 		},
+		cli.StringFlag{
+			Name:  "cpus",
+			Usage: "number of cpus, e.g. 1.5",
+		},
+		cli.Int64Flag{
+			Name:  "cpu-quota",
+			Usage: "limit cpu cfs quota in microseconds",
+		},
+		cli.Int64Flag{
+			Name:  "cpu-period",
+			Usage: "limit cpu cfs period in microseconds",
+		},
+		cli.Int64Flag{
+			Name:  "pids-limit",
+			Usage: "limit the number of processes, -1 for unlimited",
+		},
+		cli.StringFlag{
+			Name:  "blkio-weight",
+			Usage: "block io weight, between 10 and 1000",
+		},
+		cli.StringSliceFlag{
+			Name:  "blkio-weight-device",
+			Usage: "block io weight of a device, e.g. /dev/sda:500",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-read-bps",
+			Usage: "limit read rate from a device, e.g. /dev/sda:1mb",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-write-bps",
+			Usage: "limit write rate to a device, e.g. /dev/sda:1mb",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-read-iops",
+			Usage: "limit read io per second from a device, e.g. /dev/sda:1000",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-write-iops",
+			Usage: "limit write io per second to a device, e.g. /dev/sda:1000",
+		},
+		cli.StringSliceFlag{
+			Name:  "memory-threshold",
+			Usage: "record an event when memory usage crosses the threshold, e.g. 80m",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-parent",
+			Usage: "parent cgroup of the container, e.g. minidocker.slice",
+		},
 		cli.StringFlag{
 			Name:  "cpuset",
 			Usage: "cpuset limit",
@@ -58,14 +132,98 @@ var RunCommand = cli.Command{
 			Name:  "name",
 			Usage: "container name",
 		},
-    cli.StringFlag{
-      Name: "net",
-      Usage: "container network",
-    },
-    cli.StringSliceFlag{
-      Name: "p",
-      Usage: "port mapping",
-    },
+		cli.StringSliceFlag{
+			Name:  "net",
+			Usage: "container network, can be specified multiple times",
+		},
+		cli.StringSliceFlag{
+			Name:  "p",
+			Usage: "publish container ports, [hostIP:][hostPort[-range]:]containerPort[-range][/tcp|udp]",
+		},
+		cli.BoolFlag{
+			Name:  "P",
+			Usage: "publish all exposed ports to random host ports",
+		},
+		cli.StringSliceFlag{
+			Name:  "expose",
+			Usage: "expose container ports, port[-range][/tcp|udp]",
+		},
+		cli.StringFlag{
+			Name:  "ip",
+			Usage: "container ipv4 address",
+		},
+		cli.StringFlag{
+			Name:  "ip6",
+			Usage: "container ipv6 address",
+		},
+		cli.StringFlag{
+			Name:  "mac-address",
+			Usage: "container mac address",
+		},
+		cli.StringFlag{
+			Name:  "hostname",
+			Usage: "container host name",
+		},
+		cli.StringFlag{
+			Name:  "domainname",
+			Usage: "container NIS domain name",
+		},
+		cli.StringSliceFlag{
+			Name:  "add-host",
+			Usage: "add a custom host-to-IP mapping (host:ip)",
+		},
+		cli.StringSliceFlag{
+			Name:  "dns",
+			Usage: "set custom dns servers",
+		},
+		cli.StringSliceFlag{
+			Name:  "dns-search",
+			Usage: "set custom dns search domains",
+		},
+		cli.StringSliceFlag{
+			Name:  "device",
+			Usage: "add a host device to the container (/dev/foo[:/dev/bar][:rwm])",
+		},
+		cli.StringSliceFlag{
+			Name:  "cap-add",
+			Usage: "add linux capabilities",
+		},
+		cli.StringSliceFlag{
+			Name:  "cap-drop",
+			Usage: "drop linux capabilities",
+		},
+		cli.BoolFlag{
+			Name:  "privileged",
+			Usage: "give extended privileges to this container",
+		},
+		cli.StringSliceFlag{
+			Name:  "security-opt",
+			Usage: "security options (seccomp=profile.json|unconfined, no-new-privileges, systempaths=unconfined, masked-path=/path, readonly-path=/path)",
+		},
+		cli.BoolFlag{
+			Name:  "read-only",
+			Usage: "mount the container's root filesystem as read only",
+		},
+		cli.StringSliceFlag{
+			Name:  "tmpfs",
+			Usage: "mount a tmpfs directory (/path[:options])",
+		},
+		cli.StringFlag{
+			Name:  "user, u",
+			Usage: "username or uid (format: name|uid[:group|gid])",
+		},
+		cli.StringSliceFlag{
+			Name:  "group-add",
+			Usage: "add additional groups to join",
+		},
+		cli.StringSliceFlag{
+			Name:  "ulimit",
+			Usage: "ulimit options (name=soft[:hard], e.g. nofile=1024:2048)",
+		},
+		cli.BoolFlag{
+			Name:  "init",
+			Usage: "run an init inside the container that forwards signals and reaps processes",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
@@ -76,9 +234,19 @@ var RunCommand = cli.Command{
 			cmdArr = append(cmdArr, arg)
 		}
 		resConf := &subsystems.ResourceConfig{
-			MemoryLimit: context.String("m"),
-			CpuSet:      context.String("cpuset"),
-			CpuShare:    context.String("cpushare"),
+			CpuSet: context.String("cpuset"),
+		}
+		if err := parseMemoryFlags(context, resConf); err != nil {
+			return err
+		}
+		if err := parseCpuFlags(context, resConf); err != nil {
+			return err
+		}
+		if context.IsSet("pids-limit") {
+			resConf.PidsLimit = context.Int64("pids-limit")
+		}
+		if err := parseBlkioFlags(context, resConf); err != nil {
+			return err
 		}
 
 		imageName := cmdArr[0]
@@ -88,17 +256,118 @@ var RunCommand = cli.Command{
 		// tty 与 detach 不能共存
 		createTty := context.Bool("ti")
 		detach := context.Bool("d")
-    network := context.String("net")
+		networks := context.StringSlice("net")
 
 		// environment
 		envSilice := context.StringSlice("e")
-    portmapping := context.StringSlice("p")
+		portmapping := context.StringSlice("p")
 
 		if createTty && detach {
 			return fmt.Errorf("ti and d paramter can not both provided")
 		}
 		containerName := context.String("name")
-		Run(createTty, cmdArr, resConf, volume, containerName, imageName, envSilice, network, portmapping)
+
+		// hostname and dns
+		hostConfig := &container.HostConfig{
+			Hostname:   context.String("hostname"),
+			Domainname: context.String("domainname"),
+			ExtraHosts: context.StringSlice("add-host"),
+			Dns:        context.StringSlice("dns"),
+			DnsSearch:  context.StringSlice("dns-search"),
+		}
+		for _, extraHost := range hostConfig.ExtraHosts {
+			if _, _, err := container.ParseExtraHost(extraHost); err != nil {
+				return err
+			}
+		}
+		for _, dns := range hostConfig.Dns {
+			if net.ParseIP(dns) == nil {
+				return fmt.Errorf("invalid dns server %s", dns)
+			}
+		}
+		// static ip and mac
+		if err := parseAddressFlags(context, hostConfig); err != nil {
+			return err
+		}
+		// published ports
+		for _, spec := range portmapping {
+			if _, err := container.ParsePortSpec(spec); err != nil {
+				return err
+			}
+		}
+		hostConfig.ExposedPorts = context.StringSlice("expose")
+		for _, spec := range hostConfig.ExposedPorts {
+			if _, err := container.ParseExposedPort(spec); err != nil {
+				return err
+			}
+		}
+		hostConfig.PublishAllPorts = context.Bool("P")
+		if len(networks) == 0 && (len(portmapping) > 0 || hostConfig.PublishAllPorts) {
+			return fmt.Errorf("publishing ports requires --net")
+		}
+		// devices
+		for _, deviceStr := range context.StringSlice("device") {
+			device, err := container.ParseDevice(deviceStr)
+			if err != nil {
+				return err
+			}
+			rule, err := device.CgroupRule()
+			if err != nil {
+				return err
+			}
+			hostConfig.Devices = append(hostConfig.Devices, *device)
+			resConf.Devices = append(resConf.Devices, rule)
+		}
+		// capabilities
+		hostConfig.CapAdd = context.StringSlice("cap-add")
+		hostConfig.CapDrop = context.StringSlice("cap-drop")
+		hostConfig.Privileged = context.Bool("privileged")
+		caps, err := container.GetCapabilities(hostConfig.CapAdd, hostConfig.CapDrop, hostConfig.Privileged)
+		if err != nil {
+			return err
+		}
+		hostConfig.Capabilities = caps
+		if hostConfig.Privileged {
+			// 特权容器可以访问所有设备
+			resConf.Devices = append(resConf.Devices, "a *:* rwm")
+		}
+		// cgroup parent, 全局默认值可以通过 --default-cgroup-parent 配置
+		hostConfig.CgroupParent = context.String("cgroup-parent")
+		if hostConfig.CgroupParent == "" {
+			hostConfig.CgroupParent = context.GlobalString("default-cgroup-parent")
+		}
+		if err := cgroups.ValidateCgroupParent(hostConfig.CgroupParent); err != nil {
+			return err
+		}
+		for _, threshold := range context.StringSlice("memory-threshold") {
+			size, err := subsystems.ParseSize(threshold)
+			if err != nil || size <= 0 {
+				return fmt.Errorf("invalid memory threshold %s", threshold)
+			}
+			hostConfig.MemoryThresholds = append(hostConfig.MemoryThresholds, size)
+		}
+		hostConfig.Init = context.Bool("init")
+		// user
+		hostConfig.User = context.String("user")
+		hostConfig.GroupAdd = context.StringSlice("group-add")
+		// rlimits, 全局默认值可以通过 --default-ulimit 配置
+		ulimits, err := container.MergeUlimits(context.GlobalStringSlice("default-ulimit"), context.StringSlice("ulimit"))
+		if err != nil {
+			return err
+		}
+		hostConfig.Ulimits = ulimits
+		// rootfs
+		hostConfig.ReadonlyRootfs = context.Bool("read-only")
+		hostConfig.Tmpfs = context.StringSlice("tmpfs")
+		if err := container.ValidateTmpfs(hostConfig.Tmpfs); err != nil {
+			return err
+		}
+		// seccomp and system paths
+		hostConfig.SecurityOpt = context.StringSlice("security-opt")
+		if err := container.ParseSecurityOpts(hostConfig); err != nil {
+			return err
+		}
+		Run(createTty, cmdArr, resConf, volume, containerName, imageName, envSilice, networks, portmapping, hostConfig)
 		return nil
 	},
 }
@@ -144,6 +413,12 @@ var LogCommand = cli.Command{
 var ExecCommand = cli.Command{
 	Name:  "exec",
 	Usage: "exec a command into container",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "user, u",
+			Usage: "username or uid (format: name|uid[:group|gid])",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		// this is for callback
 		if os.Getenv(ENV_EXEC_PID) != "" {
@@ -158,7 +433,7 @@ var ExecCommand = cli.Command{
 		// 除了容器名之外的参数作为需要执行的命令处理
 		cmdArray = append(cmdArray, context.Args().Tail()...)
 		// 执行命令
-		ExecContainer(containerName, cmdArray)
+		ExecContainer(containerName, cmdArray, context.String("user"))
 		return nil
 	},
 }
@@ -189,6 +464,157 @@ var RemoveCommand = cli.Command{
 	},
 }
 
+var InspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information of a container",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		containerName := context.Args().Get(0)
+		inspectContainer(containerName)
+		return nil
+	},
+}
+
+var PortCommand = cli.Command{
+	Name:      "port",
+	Usage:     "list port mappings of a container",
+	ArgsUsage: "container [port[/proto]]",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		return listPorts(context.Args().Get(0), context.Args().Get(1))
+	},
+}
+
+var UpdateCommand = cli.Command{
+	Name:  "update",
+	Usage: "update resource limits of a running container",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "memory, m",
+			Usage: "memory limit, e.g. 512m",
+		},
+		cli.StringFlag{
+			Name:  "memory-swap",
+			Usage: "memory plus swap limit, -1 for unlimited swap",
+		},
+		cli.StringFlag{
+			Name:  "memory-reservation",
+			Usage: "memory soft limit",
+		},
+		cli.Int64Flag{
+			Name:  "memory-swappiness",
+			Usage: "tune memory swappiness, between 0 and 100",
+		},
+		cli.StringFlag{
+			Name:  "cpushare",
+			Usage: "cpushare limit",
+		},
+		cli.StringFlag{
+			Name:  "cpus",
+			Usage: "number of cpus, e.g. 1.5",
+		},
+		cli.Int64Flag{
+			Name:  "cpu-quota",
+			Usage: "limit cpu cfs quota in microseconds",
+		},
+		cli.Int64Flag{
+			Name:  "cpu-period",
+			Usage: "limit cpu cfs period in microseconds",
+		},
+		cli.Int64Flag{
+			Name:  "pids-limit",
+			Usage: "limit the number of processes, -1 for unlimited",
+		},
+		cli.StringFlag{
+			Name:  "blkio-weight",
+			Usage: "block io weight, between 10 and 1000",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		containerName := context.Args().Get(0)
+		containerInfo, err := getContainerInfoByName(containerName)
+		if err != nil {
+			return err
+		}
+		if containerInfo.HostConfig == nil {
+			containerInfo.HostConfig = &container.HostConfig{}
+		}
+		// 在原有的资源限制上覆盖指定的参数
+		resConf := &subsystems.ResourceConfig{}
+		if containerInfo.HostConfig.Resources != nil {
+			*resConf = *containerInfo.HostConfig.Resources
+		}
+		if err := parseMemoryFlags(context, resConf); err != nil {
+			return err
+		}
+		if err := parseCpuFlags(context, resConf); err != nil {
+			return err
+		}
+		if context.IsSet("pids-limit") {
+			resConf.PidsLimit = context.Int64("pids-limit")
+		}
+		if err := parseBlkioFlags(context, resConf); err != nil {
+			return err
+		}
+		return updateContainer(containerInfo, resConf)
+	},
+}
+
+var StatsCommand = cli.Command{
+	Name:  "stats",
+	Usage: "display resource usage of containers",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "no-stream",
+			Usage: "print the first result only",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: "output format, table or json",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return statsContainers(context.Args(), context.Bool("no-stream"), context.String("format"))
+	},
+}
+
+var TopCommand = cli.Command{
+	Name:  "top",
+	Usage: "display the running processes of a container",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		return topContainer(context.Args().Get(0))
+	},
+}
+
+var EventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "display oom and memory threshold events of a container",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: "output format, table or json",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("missing container name")
+		}
+		return listEvents(context.Args().Get(0), context.String("format"))
+	},
+}
+
 var NetworkCommand = cli.Command{
 	Name:  "network",
 	Usage: "container network commands",
@@ -201,9 +627,13 @@ var NetworkCommand = cli.Command{
 					Name:  "driver",
 					Usage: "network driver",
 				},
-				cli.StringFlag{
+				cli.StringSliceFlag{
 					Name:  "subnet",
-					Usage: "subnet cidr",
+					Usage: "subnet cidr, specify an ipv4 and an ipv6 subnet for dual-stack",
+				},
+				cli.BoolFlag{
+					Name:  "ipv6",
+					Usage: "enable ipv6 on the network",
 				},
 			},
 			Action: func(context *cli.Context) error {
@@ -213,13 +643,47 @@ var NetworkCommand = cli.Command{
 				if err := network.Init(); err != nil {
 					return err
 				}
-				err := network.CreateNetwork(context.String("driver"), context.String("subnet"), context.Args()[0])
+				err := network.CreateNetwork(context.String("driver"), context.Args()[0],
+					context.StringSlice("subnet"), context.Bool("ipv6"))
 				if err != nil {
 					return fmt.Errorf("create network error: %v", err)
 				}
 				return nil
 			},
 		},
+		{
+			Name:  "connect",
+			Usage: "connect a running container to a network",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 2 {
+					return fmt.Errorf("missing network name or container name")
+				}
+				return connectNetwork(context.Args().Get(0), context.Args().Get(1))
+			},
+		},
+		{
+			Name:  "disconnect",
+			Usage: "disconnect a container from a network",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 2 {
+					return fmt.Errorf("missing network name or container name")
+				}
+				return disconnectNetwork(context.Args().Get(0), context.Args().Get(1))
+			},
+		},
+		{
+			Name:  "inspect",
+			Usage: "display detailed information of a network",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("missing network name")
+				}
+				if err := network.Init(); err != nil {
+					return err
+				}
+				return network.InspectNetwork(context.Args().Get(0))
+			},
+		},
 		{
 			Name:  "list",
 			Usage: "list container network",
@@ -249,3 +713,131 @@ var NetworkCommand = cli.Command{
 		},
 	},
 }
+
+// 解析内存相关的参数, 大小支持k, m, g等单位
+func parseMemoryFlags(context *cli.Context, resConf *subsystems.ResourceConfig) error {
+	sizes := []struct {
+		flag  string
+		value *int64
+	}{
+		{"m", &resConf.MemoryLimit},
+		{"memory-swap", &resConf.MemorySwap},
+		{"memory-reservation", &resConf.MemoryReservation},
+	}
+	for _, s := range sizes {
+		v := context.String(s.flag)
+		if v == "" {
+			continue
+		}
+		if s.flag == "memory-swap" && v == "-1" {
+			*s.value = -1
+			continue
+		}
+		size, err := subsystems.ParseSize(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", s.flag, err)
+		}
+		*s.value = size
+	}
+	if context.Bool("oom-kill-disable") {
+		resConf.OomKillDisable = true
+	}
+	if context.IsSet("memory-swappiness") {
+		swappiness := context.Int64("memory-swappiness")
+		resConf.MemorySwappiness = &swappiness
+	}
+	return subsystems.ValidateMemory(resConf)
+}
+
+// 解析cpu相关的参数, 只覆盖指定了的参数
+func parseCpuFlags(context *cli.Context, resConf *subsystems.ResourceConfig) error {
+	if context.IsSet("cpushare") {
+		resConf.CpuShare = context.String("cpushare")
+	}
+	if context.IsSet("cpu-period") {
+		resConf.CpuPeriod = context.Int64("cpu-period")
+	}
+	if context.IsSet("cpu-quota") {
+		resConf.CpuQuota = context.Int64("cpu-quota")
+	}
+	if cpus := context.String("cpus"); cpus != "" {
+		if context.IsSet("cpu-quota") {
+			return fmt.Errorf("cpus and cpu-quota can not both provided")
+		}
+		quota, err := subsystems.CpusToQuota(cpus, resConf.CpuPeriod)
+		if err != nil {
+			return err
+		}
+		resConf.CpuQuota = quota
+	}
+	return subsystems.ValidateCpuQuota(resConf.CpuQuota, resConf.CpuPeriod)
+}
+
+// 解析块设备io相关的参数
+func parseBlkioFlags(context *cli.Context, resConf *subsystems.ResourceConfig) error {
+	if weight := context.String("blkio-weight"); weight != "" {
+		w, err := subsystems.ParseBlkioWeight(weight)
+		if err != nil {
+			return err
+		}
+		resConf.BlkioWeight = w
+	}
+	for _, wd := range context.StringSlice("blkio-weight-device") {
+		weightDevice, err := subsystems.ParseWeightDevice(wd)
+		if err != nil {
+			return err
+		}
+		resConf.BlkioWeightDevice = append(resConf.BlkioWeightDevice, *weightDevice)
+	}
+	throttles := []struct {
+		flag    string
+		size    bool
+		devices *[]subsystems.ThrottleDevice
+	}{
+		{"device-read-bps", true, &resConf.BlkioDeviceReadBps},
+		{"device-write-bps", true, &resConf.BlkioDeviceWriteBps},
+		{"device-read-iops", false, &resConf.BlkioDeviceReadIOps},
+		{"device-write-iops", false, &resConf.BlkioDeviceWriteIOps},
+	}
+	for _, t := range throttles {
+		for _, td := range context.StringSlice(t.flag) {
+			throttleDevice, err := subsystems.ParseThrottleDevice(td, t.size)
+			if err != nil {
+				return err
+			}
+			*t.devices = append(*t.devices, *throttleDevice)
+		}
+	}
+	return nil
+}
+
+// 解析静态ip和mac地址参数, 需要同时指定网络
+func parseAddressFlags(context *cli.Context, hostConfig *container.HostConfig) error {
+	if ip := context.String("ip"); ip != "" {
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() == nil {
+			return fmt.Errorf("invalid ipv4 address %s", ip)
+		}
+		hostConfig.IPAddress = ip
+	}
+	if ip6 := context.String("ip6"); ip6 != "" {
+		if parsed := net.ParseIP(ip6); parsed == nil || parsed.To4() != nil {
+			return fmt.Errorf("invalid ipv6 address %s", ip6)
+		}
+		hostConfig.IPv6Address = ip6
+	}
+	if macAddress := context.String("mac-address"); macAddress != "" {
+		mac, err := net.ParseMAC(macAddress)
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("invalid mac address %s", macAddress)
+		}
+		// 组播地址不能作为网卡地址
+		if mac[0]&1 == 1 {
+			return fmt.Errorf("invalid mac address %s, multicast address is not allowed", macAddress)
+		}
+		hostConfig.MacAddress = mac.String()
+	}
+	if len(context.StringSlice("net")) == 0 && (hostConfig.IPAddress != "" || hostConfig.IPv6Address != "" || hostConfig.MacAddress != "") {
+		return fmt.Errorf("ip and mac address require --net")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"minidocker/container"
+	"os"
+	"text/tabwriter"
+)
+
+// 输出容器的oom和内存阈值等事件
+func listEvents(containerName string, format string) error {
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	if _, err := getContainerInfoByName(containerName); err != nil {
+		return err
+	}
+	events, err := container.ReadEvents(containerName)
+	if err != nil {
+		return fmt.Errorf("read events of container %s error %v", containerName, err)
+	}
+	if format == "json" {
+		content, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "TIME\tTYPE\tMESSAGE\n")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", event.Time, event.Type, event.Message)
+	}
+	return w.Flush()
+}
@@ -9,6 +9,7 @@ import (
 
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -16,17 +17,20 @@ import (
 
 const ENV_EXEC_PID = "minidocker_pid"
 const ENV_EXEC_CMD = "minidocker_command"
+const ENV_EXEC_UID = "minidocker_uid"
+const ENV_EXEC_GID = "minidocker_gid"
+const ENV_EXEC_GROUPS = "minidocker_groups"
 
 func getEnvsByPid(pid string) []string {
-  // 进程的环境变量获取地址 /proc/xx/environ
-  path := fmt.Sprintf("/proc/%s/environ", pid)
-  contentBytes, err := ioutil.ReadFile(path)
-  if err != nil {
-    logrus.Errorf("ReadFile %s error %v", path, err)
-    return nil
-  }
-  envs := strings.Split(string(contentBytes), "\u0000")
-  return envs
+	// 进程的环境变量获取地址 /proc/xx/environ
+	path := fmt.Sprintf("/proc/%s/environ", pid)
+	contentBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		logrus.Errorf("ReadFile %s error %v", path, err)
+		return nil
+	}
+	envs := strings.Split(string(contentBytes), "\u0000")
+	return envs
 }
 
 func getContainerPidByName(containerName string) (string, error) {
@@ -43,10 +47,35 @@ func getContainerPidByName(containerName string) (string, error) {
 	return containerInfo.Pid, nil
 }
 
-func ExecContainer(containerName string, comArray []string) {
-	pid, err := getContainerPidByName(containerName)
+// 去掉环境变量中的HOME
+func removeHomeEnv(envs []string) []string {
+	var result []string
+	for _, env := range envs {
+		if !strings.HasPrefix(env, "HOME=") {
+			result = append(result, env)
+		}
+	}
+	return result
+}
+
+func ExecContainer(containerName string, comArray []string, user string) {
+	containerInfo, err := getContainerInfoByName(containerName)
 	if err != nil {
-		logrus.Errorf("Exec container getContainerPidByName %s error %v", containerName, err)
+		logrus.Errorf("Exec container getContainerInfoByName %s error %v", containerName, err)
+		return
+	}
+	pid := containerInfo.Pid
+	// 默认使用容器run时指定的用户
+	var groupAdd []string
+	if user == "" && containerInfo.HostConfig != nil {
+		user = containerInfo.HostConfig.User
+		groupAdd = containerInfo.HostConfig.GroupAdd
+	}
+	// 与init相同, 从容器的rootfs中解析用户
+	mntUrl := fmt.Sprintf(container.MntUrl, containerName)
+	execUser, err := container.GetExecUser(user, groupAdd, mntUrl)
+	if err != nil {
+		logrus.Errorf("Exec container get user %s error %v", user, err)
 		return
 	}
 	cmdStr := strings.Join(comArray, " ")
@@ -60,11 +89,19 @@ func ExecContainer(containerName string, comArray []string) {
 
 	os.Setenv(ENV_EXEC_PID, pid)
 	os.Setenv(ENV_EXEC_CMD, cmdStr)
+	os.Setenv(ENV_EXEC_UID, strconv.Itoa(execUser.Uid))
+	os.Setenv(ENV_EXEC_GID, strconv.Itoa(execUser.Gid))
+	var groups []string
+	for _, gid := range execUser.Sgids {
+		groups = append(groups, strconv.Itoa(gid))
+	}
+	os.Setenv(ENV_EXEC_GROUPS, strings.Join(groups, ","))
 
-  // 获取环境变量
-  containerEnvs := getEnvsByPid(pid)
-  // 设置环境变量
-  cmd.Env = append(os.Environ(), containerEnvs...)
+	// 获取环境变量
+	containerEnvs := getEnvsByPid(pid)
+	// 设置环境变量
+	cmd.Env = append(removeHomeEnv(os.Environ()), removeHomeEnv(containerEnvs)...)
+	cmd.Env = append(cmd.Env, "HOME="+execUser.Home)
 
 	if err := cmd.Run(); err != nil {
 		logrus.Errorf("Exec container %s error %v", containerName, err)
@@ -0,0 +1,24 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+func inspectContainer(containerName string) {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		logrus.Errorf("Get container %s info error %v", containerName, err)
+		return
+	}
+	updateOOMKilled(containerInfo)
+	// 格式化输出容器信息
+	content, err := json.MarshalIndent(containerInfo, "", "  ")
+	if err != nil {
+		logrus.Errorf("Json marshal %s error %v", containerName, err)
+		return
+	}
+	fmt.Println(string(content))
+}
@@ -44,17 +44,22 @@ func ListContainers() {
       logrus.Errorf("Get containerInfo error %v", err)
       continue
     }
+    updateOOMKilled(tmpContainer)
     containers = append(containers, tmpContainer)
   }
 
   w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
   fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tCOMMAND\tVOLUME\tCREATED\n")
   for _, item := range containers {
+    status := item.Status
+    if item.OOMKilled {
+      status += " (OOMKilled)"
+    }
     fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
       item.Id,
       item.Name,
       item.Pid,
-      item.Status,
+      status,
       item.Command,
       item.Volume,
       item.CreateTime)
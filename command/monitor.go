@@ -0,0 +1,107 @@
+package command
+
+import (
+	"fmt"
+	"minidocker/cgroups"
+	"minidocker/cgroups/subsystems"
+	"minidocker/container"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 检查容器进程是否退出的间隔
+const monitorInterval = time.Second
+
+// 启动后台的monitor进程, 脱离当前会话, 在容器退出后自行结束
+func startMonitor(containerName string) error {
+	cmd := exec.Command("/proc/self/exe", "monitor", containerName)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+func recordEvent(containerName string, eventType string, message string) {
+	if err := container.AppendEvent(containerName, eventType, message); err != nil {
+		logrus.Errorf("record event %s of container %s error %v", eventType, containerName, err)
+	}
+}
+
+// 监听容器cgroup的oom和内存阈值事件, 记录到容器的events.json
+func monitorContainer(containerName string) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(containerInfo.Pid)
+	if err != nil {
+		return fmt.Errorf("invalid container pid %s", containerInfo.Pid)
+	}
+	cgroupPath := containerCgroupPath(containerInfo)
+
+	oomCh, err := cgroups.NotifyOOM(cgroupPath)
+	if err != nil {
+		logrus.Errorf("watch oom of container %s error %v", containerName, err)
+	}
+	// 将所有阈值的通知合并到一个channel
+	thresholdCh := make(chan int64)
+	if containerInfo.HostConfig != nil {
+		for _, threshold := range containerInfo.HostConfig.MemoryThresholds {
+			ch, err := cgroups.NotifyMemoryThreshold(cgroupPath, threshold)
+			if err != nil {
+				logrus.Errorf("watch memory threshold %d of container %s error %v", threshold, containerName, err)
+				continue
+			}
+			go func(threshold int64, ch <-chan struct{}) {
+				for range ch {
+					thresholdCh <- threshold
+				}
+			}(threshold, ch)
+		}
+	}
+
+	lastKill, _ := subsystems.GetOOMKillCount(cgroupPath)
+	// oom_kill计数可能在oom通知之后才更新, 所以每次检查时都比较
+	checkOOMKill := func() {
+		count, err := subsystems.GetOOMKillCount(cgroupPath)
+		if err != nil || count <= lastKill {
+			return
+		}
+		recordEvent(containerName, container.EventOOMKill,
+			fmt.Sprintf("%d process(es) killed by oom killer", count-lastKill))
+		lastKill = count
+		if err := markOOMKilled(containerName); err != nil {
+			logrus.Errorf("record oom killed of container %s error %v", containerName, err)
+		}
+	}
+	ticker := time.NewTicker(monitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case _, ok := <-oomCh:
+			if !ok {
+				oomCh = nil
+				continue
+			}
+			recordEvent(containerName, container.EventOOM, "container is out of memory")
+			checkOOMKill()
+		case threshold := <-thresholdCh:
+			usage := subsystems.GetStats(cgroupPath).MemoryUsage
+			recordEvent(containerName, container.EventMemoryThreshold,
+				fmt.Sprintf("memory usage %s crossed threshold %s", formatSize(usage), formatSize(uint64(threshold))))
+		case <-ticker.C:
+			checkOOMKill()
+			// 容器进程退出后结束
+			if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"fmt"
+	"minidocker/container"
+	"minidocker/network"
+)
+
+// 将运行中的容器连接到网络
+func connectNetwork(networkName, containerName string) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	if containerInfo.Status != container.RUNNING {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	if err := network.Init(); err != nil {
+		return err
+	}
+	if err := network.Connect(networkName, containerInfo); err != nil {
+		return err
+	}
+	return writeContainerInfo(containerInfo)
+}
+
+// 将容器从网络断开
+func disconnectNetwork(networkName, containerName string) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	if err := network.Init(); err != nil {
+		return err
+	}
+	if err := network.Disconnect(networkName, containerInfo); err != nil {
+		return err
+	}
+	return writeContainerInfo(containerInfo)
+}
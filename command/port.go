@@ -0,0 +1,88 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"minidocker/container"
+	"strconv"
+	"strings"
+)
+
+// 其他运行中的容器已经发布的宿主机端口
+func usedHostPorts() []container.PortBinding {
+	var used []container.PortBinding
+	dirURL := fmt.Sprintf(container.DefaultInfoLocation, "")
+	files, err := ioutil.ReadDir(dirURL[:len(dirURL)-1])
+	if err != nil {
+		return used
+	}
+	for _, file := range files {
+		containerInfo, err := getContainerInfo(file)
+		if err != nil || containerInfo.Status != container.RUNNING {
+			continue
+		}
+		used = append(used, containerInfo.Ports...)
+	}
+	return used
+}
+
+// 解析-p和-P参数得到要发布的端口, 并分配随机端口
+func publishedPorts(portmapping []string, hostConfig *container.HostConfig) ([]container.PortBinding, error) {
+	var bindings []container.PortBinding
+	published := map[string]bool{}
+	for _, spec := range portmapping {
+		pbs, err := container.ParsePortSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, pb := range pbs {
+			published[fmt.Sprintf("%d/%s", pb.ContainerPort, pb.Protocol)] = true
+		}
+		bindings = append(bindings, pbs...)
+	}
+	if hostConfig.PublishAllPorts {
+		// 已经通过-p发布的端口不再重复发布
+		for _, spec := range hostConfig.ExposedPorts {
+			pbs, err := container.ParseExposedPort(spec)
+			if err != nil {
+				return nil, err
+			}
+			for _, pb := range pbs {
+				if !published[fmt.Sprintf("%d/%s", pb.ContainerPort, pb.Protocol)] {
+					bindings = append(bindings, pb)
+				}
+			}
+		}
+	}
+	if len(bindings) == 0 {
+		return nil, nil
+	}
+	return container.AllocateHostPorts(bindings, usedHostPorts())
+}
+
+// 打印容器发布的端口, 可以只查看指定的容器端口
+func listPorts(containerName string, privatePort string) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	port, proto := privatePort, ""
+	if i := strings.Index(privatePort, "/"); i >= 0 {
+		port, proto = privatePort[:i], privatePort[i+1:]
+	}
+	found := false
+	for _, pb := range containerInfo.Ports {
+		if port != "" && strconv.Itoa(pb.ContainerPort) != port {
+			continue
+		}
+		if proto != "" && pb.Protocol != proto {
+			continue
+		}
+		found = true
+		fmt.Println(pb)
+	}
+	if privatePort != "" && !found {
+		return fmt.Errorf("no public port %s published for %s", privatePort, containerName)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package command
 import (
 	"fmt"
 	"minidocker/container"
+	"minidocker/network"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -18,6 +19,12 @@ func removeContainer(containerName string) {
     logrus.Errorf("Cann't remove running container")
     return
   }
+  // 断开容器的网络, 删除veth, iptables规则和网络端点文件
+  if err := network.Init(); err != nil {
+    logrus.Errorf("network init error %v", err)
+  } else if err := network.DisconnectAll(containerInfo); err != nil {
+    logrus.Errorf("disconnect container %s network error %v", containerName, err)
+  }
   dirURL := fmt.Sprintf(container.DefaultInfoLocation, containerName)
   if err := os.RemoveAll(dirURL); err != nil {
     logrus.Errorf("Remove file %s error %v", dirURL, err)
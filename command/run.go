@@ -8,7 +8,9 @@ import (
 	"minidocker/cgroups/subsystems"
 	"minidocker/container"
 	"minidocker/network"
+	"net"
 	"os"
+	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -34,7 +36,7 @@ func randStringBytes(n int) string {
 	return string(b)
 }
 
-func recordContainerInfo(containerPid int, commandArray []string, containerName string, containerId string, volume string) (string, error) {
+func recordContainerInfo(containerPid int, commandArray []string, containerName string, containerId string, volume string, hostConfig *container.HostConfig) (string, error) {
 	// 以当前时间为容器创建时间
 	createTime := time.Now().Format("2006-01-01 14:00:00")
 	command := strings.Join(commandArray, "")
@@ -47,6 +49,7 @@ func recordContainerInfo(containerPid int, commandArray []string, containerName
 		Status:     container.RUNNING,
 		Name:       containerName,
 		Volume:     volume,
+		HostConfig: hostConfig,
 	}
 
 	// 将容器信息序列化成字符串
@@ -87,11 +90,27 @@ func deleteContainerInfo(containerId string) {
 	}
 }
 
-func Run(tty bool, cmdArr []string, resConf *subsystems.ResourceConfig, volume string, containerName string, imageName string, envSlice []string, nw string, portmapping []string) {
+// 容器初始化失败时杀死还在等待命令的init进程, 并清理工作目录和容器信息
+func abortContainer(childProcess *exec.Cmd, writePipe *os.File, volume string, containerName string) {
+	writePipe.Close()
+	if err := childProcess.Process.Kill(); err != nil {
+		logrus.Errorf("kill container process error %v", err)
+	}
+	childProcess.Wait()
+	container.DeleteWorkSpace(volume, containerName)
+	deleteContainerInfo(containerName)
+}
+
+func Run(tty bool, cmdArr []string, resConf *subsystems.ResourceConfig, volume string, containerName string, imageName string, envSlice []string, nws []string, portmapping []string, hostConfig *container.HostConfig) {
 	containerId := randStringBytes(10)
 	if containerName == "" {
 		containerName = containerId
 	}
+	hostConfig.Resources = resConf
+	// 默认使用容器id作为主机名
+	if hostConfig.Hostname == "" {
+		hostConfig.Hostname = containerId
+	}
 	childProcess, writePipe := container.NewParentProcess(tty, containerName, volume, imageName, envSlice)
 	if childProcess == nil {
 		logrus.Errorf("New parent process error")
@@ -100,20 +119,36 @@ func Run(tty bool, cmdArr []string, resConf *subsystems.ResourceConfig, volume s
 	if err := childProcess.Start(); err != nil {
 		logrus.Error(err)
 	}
-	containerName, err := recordContainerInfo(childProcess.Process.Pid, cmdArr, containerName, containerId, volume)
+	containerName, err := recordContainerInfo(childProcess.Process.Pid, cmdArr, containerName, containerId, volume, hostConfig)
 	if err != nil {
 		logrus.Errorf("Record container info error %v", err)
 		return
 	}
 
-	// use containerId as cgroup name
-	cgroupManager := cgroups.NewCgroupManager(containerId)
+	if err := container.CreateSeccompProfile(containerName, hostConfig); err != nil {
+		logrus.Errorf("create seccomp profile error %v", err)
+		abortContainer(childProcess, writePipe, volume, containerName)
+		return
+	}
+
+	// use containerId as cgroup name, under the cgroup parent
+	cgroupPath, err := cgroups.CgroupPath(hostConfig.CgroupParent, containerId)
+	if err != nil {
+		logrus.Errorf("get cgroup path error %v", err)
+		abortContainer(childProcess, writePipe, volume, containerName)
+		return
+	}
+	cgroupManager := cgroups.NewCgroupManager(cgroupPath)
 	defer cgroupManager.Destroy()
 	if err := cgroupManager.Set(resConf); err != nil {
 		logrus.Errorf("cgroupManager set resConf error %v", err)
+		abortContainer(childProcess, writePipe, volume, containerName)
+		return
 	}
 	if err := cgroupManager.Apply(childProcess.Process.Pid); err != nil {
 		logrus.Errorf("cgroupManager Apply childProcess %d error %v", childProcess.Process.Pid, err)
+		abortContainer(childProcess, writePipe, volume, containerName)
+		return
 	}
 
 	containerInfo := &container.ContainerInfo{
@@ -121,18 +156,58 @@ func Run(tty bool, cmdArr []string, resConf *subsystems.ResourceConfig, volume s
 		Pid:         strconv.Itoa(childProcess.Process.Pid),
 		Name:        containerName,
 		PortMapping: portmapping,
+		HostConfig:  hostConfig,
 	}
+	// 发布的端口, 随机端口在连接网络前分配
+	ports, err := publishedPorts(portmapping, hostConfig)
+	if err != nil {
+		logrus.Errorf("publish ports error %v", err)
+		abortContainer(childProcess, writePipe, volume, containerName)
+		return
+	}
+	containerInfo.Ports = ports
 	// network
-	if nw != "" {
+	if len(nws) > 0 {
 		// config container network
 		if err := network.Init(); err != nil {
 			logrus.Errorf("network init error %v", err)
 		}
 
-		if err := network.Connect(nw, containerInfo); err != nil {
-			logrus.Errorf("error connect network %v", err)
-			return
+		// 依次连接各个网络, 容器内的接口为eth0, eth1...
+		for _, nw := range nws {
+			if err := network.Connect(nw, containerInfo); err != nil {
+				logrus.Errorf("error connect network %v", err)
+				// 释放已经连接的网络
+				if err := network.DisconnectAll(containerInfo); err != nil {
+					logrus.Errorf("network Disconnect failed %v", err)
+				}
+				abortContainer(childProcess, writePipe, volume, containerName)
+				return
+			}
+		}
+		if err := recordContainerNetwork(containerName, containerInfo); err != nil {
+			logrus.Errorf("record container network error %v", err)
+		}
+	}
+
+	// hosts, hostname, resolv.conf
+	// 只有ipv6地址的容器使用ipv6地址作为主机名解析
+	hostIP := containerInfo.IPAddress
+	if hostIP == "" {
+		hostIP = containerInfo.IPv6Address
+	}
+	if err := container.CreateHostFiles(containerName, hostConfig, net.ParseIP(hostIP)); err != nil {
+		logrus.Errorf("create host files error %v", err)
+		if err := network.DisconnectAll(containerInfo); err != nil {
+			logrus.Errorf("network Disconnect failed %v", err)
 		}
+		abortContainer(childProcess, writePipe, volume, containerName)
+		return
+	}
+
+	// 监听oom和内存阈值事件
+	if err := startMonitor(containerName); err != nil {
+		logrus.Errorf("start monitor error %v", err)
 	}
 
 	sendInitCommand(cmdArr, writePipe)
@@ -140,11 +215,16 @@ func Run(tty bool, cmdArr []string, resConf *subsystems.ResourceConfig, volume s
 		if err := childProcess.Wait(); err != nil {
 			logrus.Errorf("parent Wait error %v", err)
 		}
+		if count, err := subsystems.GetOOMKillCount(cgroupPath); err == nil && count > 0 {
+			logrus.Warnf("container %s was killed by oom killer", containerName)
+		}
 		container.DeleteWorkSpace(volume, containerName)
 		deleteContainerInfo(containerName)
-    if err := network.Disconnect(nw, containerInfo); err != nil {
-      logrus.Errorf("network Disconnect failed %v", err)
-    }
+		if len(nws) > 0 {
+			if err := network.DisconnectAll(containerInfo); err != nil {
+				logrus.Errorf("network Disconnect failed %v", err)
+			}
+		}
 	}
 	os.Exit(0)
 }
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"minidocker/cgroups"
+	"minidocker/cgroups/subsystems"
+	"minidocker/container"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 将容器信息写回config.json
+func writeContainerInfo(containerInfo *container.ContainerInfo) error {
+	content, err := json.Marshal(containerInfo)
+	if err != nil {
+		return fmt.Errorf("json marshal %s error %v", containerInfo.Name, err)
+	}
+	configFilePath := fmt.Sprintf(container.DefaultInfoLocation, containerInfo.Name) + container.ConfigName
+	if err := ioutil.WriteFile(configFilePath, content, 0622); err != nil {
+		return fmt.Errorf("write file %s error %v", configFilePath, err)
+	}
+	return nil
+}
+
+// 将网络连接后得到的地址写回config.json
+func recordContainerNetwork(containerName string, netInfo *container.ContainerInfo) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	containerInfo.IPAddress = netInfo.IPAddress
+	containerInfo.IPv6Address = netInfo.IPv6Address
+	containerInfo.MacAddress = netInfo.MacAddress
+	containerInfo.Networks = netInfo.Networks
+	containerInfo.PortMapping = netInfo.PortMapping
+	containerInfo.Ports = netInfo.Ports
+	return writeContainerInfo(containerInfo)
+}
+
+// 容器的cgroup路径, 没有记录cgroup parent的容器直接使用容器id
+func containerCgroupPath(containerInfo *container.ContainerInfo) string {
+	if containerInfo.HostConfig == nil {
+		return containerInfo.Id
+	}
+	cgroupPath, err := cgroups.CgroupPath(containerInfo.HostConfig.CgroupParent, containerInfo.Id)
+	if err != nil {
+		return containerInfo.Id
+	}
+	return cgroupPath
+}
+
+// 根据cgroup中的oom_kill计数更新容器的OOMKilled状态
+// 后台运行的容器没有进程等待其退出, 所以在ps和inspect时检查
+func updateOOMKilled(containerInfo *container.ContainerInfo) {
+	if containerInfo.OOMKilled {
+		return
+	}
+	count, err := subsystems.GetOOMKillCount(containerCgroupPath(containerInfo))
+	if err != nil || count == 0 {
+		return
+	}
+	containerInfo.OOMKilled = true
+	if err := markOOMKilled(containerInfo.Name); err != nil {
+		logrus.Errorf("record oom killed of container %s error %v", containerInfo.Name, err)
+	}
+}
+
+// 重新读取config.json后只修改OOMKilled
+// 调用者持有的容器信息可能已经过期, 直接写回会覆盖update, network connect等之后写入的内容
+func markOOMKilled(containerName string) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	if containerInfo.OOMKilled {
+		return nil
+	}
+	containerInfo.OOMKilled = true
+	return writeContainerInfo(containerInfo)
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"io/ioutil"
+	"minidocker/cgroups/subsystems"
+	"minidocker/container"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkOOMKilledKeepsNewerInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "minidocker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defaultInfoLocation := container.DefaultInfoLocation
+	container.DefaultInfoLocation = dir + "/%s/"
+	defer func() { container.DefaultInfoLocation = defaultInfoLocation }()
+	if err := os.MkdirAll(filepath.Join(dir, "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &container.ContainerInfo{
+		Id:         "abcdefghij",
+		Name:       "test",
+		Status:     container.RUNNING,
+		HostConfig: &container.HostConfig{},
+	}
+	if err := writeContainerInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	// monitor启动时读取的容器信息
+	monitorInfo, err := getContainerInfoByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// monitor启动之后update和network connect写入的内容
+	info.HostConfig.Resources = &subsystems.ResourceConfig{MemoryLimit: 64 << 20}
+	info.IPAddress = "172.18.0.2"
+	info.Networks = map[string]*container.NetworkSettings{
+		"testnet": {Interface: "eth0", IPAddress: "172.18.0.2"},
+	}
+	if err := writeContainerInfo(info); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := markOOMKilled(monitorInfo.Name); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getContainerInfoByName("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.OOMKilled {
+		t.Errorf("expect OOMKilled to be recorded")
+	}
+	if got.HostConfig.Resources == nil || got.HostConfig.Resources.MemoryLimit != 64<<20 {
+		t.Errorf("updated resources lost: %+v", got.HostConfig.Resources)
+	}
+	if got.IPAddress != "172.18.0.2" || got.Networks["testnet"] == nil {
+		t.Errorf("network info lost: %s %v", got.IPAddress, got.Networks)
+	}
+}
@@ -0,0 +1,194 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"minidocker/cgroups/subsystems"
+	"minidocker/container"
+	"minidocker/network"
+	"os"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 容器的资源使用情况
+type containerStats struct {
+	Id            string  `json:"id"`
+	Name          string  `json:"name"`
+	CpuPercent    float64 `json:"cpuPercent"`
+	MemoryUsage   uint64  `json:"memoryUsage"`
+	MemoryLimit   uint64  `json:"memoryLimit"`
+	MemoryPercent float64 `json:"memoryPercent"`
+	NetRx         uint64  `json:"netRx"`
+	NetTx         uint64  `json:"netTx"`
+	BlockRead     uint64  `json:"blockRead"`
+	BlockWrite    uint64  `json:"blockWrite"`
+	Pids          uint64  `json:"pids"`
+}
+
+// 一次采样的结果, cpu使用率需要两次采样计算
+type statsSample struct {
+	stats *subsystems.Stats
+	net   *network.NetStats
+	time  time.Time
+}
+
+// 没有指定容器时统计所有运行中的容器
+func getStatsContainers(containerNames []string) ([]*container.ContainerInfo, error) {
+	if len(containerNames) == 0 {
+		dirURL := fmt.Sprintf(container.DefaultInfoLocation, "")
+		files, err := ioutil.ReadDir(dirURL[:len(dirURL)-1])
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			// 跳过network等不是容器的目录
+			if _, err := os.Stat(dirURL + file.Name() + "/" + container.ConfigName); err == nil {
+				containerNames = append(containerNames, file.Name())
+			}
+		}
+	}
+	var containers []*container.ContainerInfo
+	for _, name := range containerNames {
+		containerInfo, err := getContainerInfoByName(name)
+		if err != nil {
+			continue
+		}
+		if containerInfo.Status == container.RUNNING {
+			containers = append(containers, containerInfo)
+		}
+	}
+	return containers, nil
+}
+
+func takeSample(containerInfo *container.ContainerInfo) *statsSample {
+	sample := &statsSample{
+		stats: subsystems.GetStats(containerCgroupPath(containerInfo)),
+		net:   &network.NetStats{},
+		time:  time.Now(),
+	}
+	if netStats, err := network.GetContainerNetStats(containerInfo.Pid); err == nil {
+		sample.net = netStats
+	}
+	return sample
+}
+
+// 宿主机的总内存, 容器没有内存限制时作为上限
+func hostMemory() uint64 {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0
+	}
+	return uint64(info.Totalram) * uint64(info.Unit)
+}
+
+func calculateStats(containerInfo *container.ContainerInfo, prev, cur *statsSample) *containerStats {
+	s := &containerStats{
+		Id:          containerInfo.Id,
+		Name:        containerInfo.Name,
+		MemoryUsage: cur.stats.MemoryUsage,
+		MemoryLimit: cur.stats.MemoryLimit,
+		NetRx:       cur.net.RxBytes,
+		NetTx:       cur.net.TxBytes,
+		BlockRead:   cur.stats.BlkioRead,
+		BlockWrite:  cur.stats.BlkioWrite,
+		Pids:        cur.stats.Pids,
+	}
+	// 100%表示占满一个cpu
+	if elapsed := cur.time.Sub(prev.time).Nanoseconds(); elapsed > 0 && cur.stats.CpuUsage > prev.stats.CpuUsage {
+		s.CpuPercent = float64(cur.stats.CpuUsage-prev.stats.CpuUsage) / float64(elapsed) * 100
+	}
+	if total := hostMemory(); s.MemoryLimit == 0 || (total != 0 && s.MemoryLimit > total) {
+		s.MemoryLimit = total
+	}
+	if s.MemoryLimit != 0 {
+		s.MemoryPercent = float64(s.MemoryUsage) / float64(s.MemoryLimit) * 100
+	}
+	return s
+}
+
+// 按1024换算为可读的大小
+func formatSize(size uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	v := float64(size)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%s", v, units[i])
+}
+
+func printStats(stats []*containerStats, format string) {
+	if format == "json" {
+		content, err := json.Marshal(stats)
+		if err != nil {
+			logrus.Errorf("Json marshal stats error %v", err)
+			return
+		}
+		fmt.Println(string(content))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "ID\tNAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS\n")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\t%d\n",
+			s.Id,
+			s.Name,
+			s.CpuPercent,
+			formatSize(s.MemoryUsage), formatSize(s.MemoryLimit),
+			s.MemoryPercent,
+			formatSize(s.NetRx), formatSize(s.NetTx),
+			formatSize(s.BlockRead), formatSize(s.BlockWrite),
+			s.Pids)
+	}
+	if err := w.Flush(); err != nil {
+		logrus.Errorf("Flush error %v", err)
+	}
+}
+
+// 每秒采样一次, noStream时只输出一次
+func statsContainers(containerNames []string, noStream bool, format string) error {
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	prev := map[string]*statsSample{}
+	for {
+		containers, err := getStatsContainers(containerNames)
+		if err != nil {
+			return err
+		}
+		// 第一次采样时等待一个周期, 才能计算cpu使用率
+		if len(prev) == 0 {
+			for _, c := range containers {
+				prev[c.Id] = takeSample(c)
+			}
+			time.Sleep(time.Second)
+		}
+		var stats []*containerStats
+		next := map[string]*statsSample{}
+		for _, c := range containers {
+			cur := takeSample(c)
+			last, ok := prev[c.Id]
+			if !ok {
+				last = cur
+			}
+			stats = append(stats, calculateStats(c, last, cur))
+			next[c.Id] = cur
+		}
+		prev = next
+		if !noStream && format == "table" {
+			// 清屏后刷新
+			fmt.Print("\033[2J\033[H")
+		}
+		printStats(stats, format)
+		if noStream {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,159 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"minidocker/cgroups/subsystems"
+	"minidocker/container"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// /proc/<pid>/stat中时间的单位, 绝大多数平台为100
+const clockTicks = 100
+
+// 容器中的进程信息
+type processInfo struct {
+	User         string
+	Pid          int
+	ContainerPid string
+	Cpu          float64
+	Rss          uint64
+	Time         time.Duration
+	Command      string
+}
+
+// 读取/proc/<pid>/status中的字段
+func readProcStatus(pid int) (map[string]string, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	status := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			status[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	return status, nil
+}
+
+// 从/proc/<pid>/stat中读取utime+stime和启动时间, 单位为clock tick
+// 进程名可能包含空格和括号, 所以从最后一个')'之后开始解析
+func readProcStat(pid int) (uint64, uint64, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	stat := string(content)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	// 第一个字段是state, 对应stat中的第3个字段
+	if len(fields) < 20 {
+		return 0, 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	start, _ := strconv.ParseUint(fields[19], 10, 64)
+	return utime + stime, start, nil
+}
+
+func readUptime() (float64, error) {
+	content, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid /proc/uptime")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+func readProcCommand(pid int, status map[string]string) string {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err == nil && len(content) > 0 {
+		return strings.TrimSpace(strings.ReplaceAll(string(content), "\x00", " "))
+	}
+	// 内核线程或者僵尸进程没有cmdline
+	return "[" + status["Name"] + "]"
+}
+
+func getProcessInfo(pid int, rootfs string, uptime float64) (*processInfo, error) {
+	status, err := readProcStatus(pid)
+	if err != nil {
+		return nil, err
+	}
+	cpuTicks, startTicks, err := readProcStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	info := &processInfo{
+		Pid:     pid,
+		Time:    time.Duration(cpuTicks) * time.Second / clockTicks,
+		Command: readProcCommand(pid, status),
+	}
+	// 与ps一样, %CPU为进程启动以来的平均使用率
+	if elapsed := uptime - float64(startTicks)/clockTicks; elapsed > 0 {
+		info.Cpu = float64(cpuTicks) / clockTicks / elapsed * 100
+	}
+	// Uid: real effective saved fs
+	if uids := strings.Fields(status["Uid"]); len(uids) > 0 {
+		uid, _ := strconv.Atoi(uids[0])
+		info.User = container.LookupUserName(rootfs, uid)
+	}
+	// VmRSS: 1234 kB
+	if rss := strings.Fields(status["VmRSS"]); len(rss) > 0 {
+		kb, _ := strconv.ParseUint(rss[0], 10, 64)
+		info.Rss = kb << 10
+	}
+	// NSpid中最后一个是进程在容器pid namespace中的pid
+	if nspid := strings.Fields(status["NSpid"]); len(nspid) > 0 {
+		info.ContainerPid = nspid[len(nspid)-1]
+	} else {
+		info.ContainerPid = "-"
+	}
+	return info, nil
+}
+
+// 列出容器cgroup中的进程
+func topContainer(containerName string) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return err
+	}
+	if containerInfo.Status != container.RUNNING {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	pids, err := subsystems.GetPids(containerCgroupPath(containerInfo))
+	if err != nil {
+		return fmt.Errorf("get processes of container %s error %v", containerName, err)
+	}
+	uptime, err := readUptime()
+	if err != nil {
+		return err
+	}
+	rootfs := fmt.Sprintf(container.MntUrl, containerName)
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 3, ' ', 0)
+	fmt.Fprint(w, "USER\tPID\tCONTAINER PID\t%CPU\tRSS\tTIME\tCOMMAND\n")
+	for _, pid := range pids {
+		info, err := getProcessInfo(pid, rootfs, uptime)
+		if err != nil {
+			// 进程可能已经退出
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.1f\t%s\t%s\t%s\n",
+			info.User,
+			info.Pid,
+			info.ContainerPid,
+			info.Cpu,
+			formatSize(info.Rss),
+			info.Time,
+			info.Command)
+	}
+	return w.Flush()
+}
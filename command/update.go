@@ -0,0 +1,33 @@
+package command
+
+import (
+	"fmt"
+	"minidocker/cgroups"
+	"minidocker/cgroups/subsystems"
+	"minidocker/container"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 将新的资源限制写入容器的cgroup, 并保存到config.json
+func updateContainer(containerInfo *container.ContainerInfo, resConf *subsystems.ResourceConfig) error {
+	if containerInfo.Status != container.RUNNING {
+		return fmt.Errorf("container %s is not running", containerInfo.Name)
+	}
+	cgroupPath := containerCgroupPath(containerInfo)
+	// 新设置的限制所在的cgroup可能还没有容器进程, 更新时一并加入
+	pids, err := subsystems.GetPids(cgroupPath)
+	if err != nil {
+		return fmt.Errorf("get container %s processes error %v", containerInfo.Name, err)
+	}
+	cgroupManager := cgroups.NewCgroupManager(cgroupPath)
+	if err := cgroupManager.Update(resConf, pids); err != nil {
+		return fmt.Errorf("update container %s resources error %v", containerInfo.Name, err)
+	}
+	containerInfo.HostConfig.Resources = resConf
+	if err := writeContainerInfo(containerInfo); err != nil {
+		logrus.Errorf("record container %s resources error %v", containerInfo.Name, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const capLastCapPath = "/proc/sys/kernel/cap_last_cap"
+
+// capability名称与编号, 见 linux/capability.h
+var capabilityList = map[string]uint{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// 容器默认拥有的capability, 与常见容器运行时保持一致
+var DefaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+// 规范化capability名称, 支持省略CAP_前缀和小写
+func normalizeCapability(name string) (string, error) {
+	name = strings.ToUpper(name)
+	if name == "ALL" {
+		return name, nil
+	}
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+	if _, ok := capabilityList[name]; !ok {
+		return "", fmt.Errorf("unknown capability %s", name)
+	}
+	return name, nil
+}
+
+func allCapabilities() []string {
+	var caps []string
+	for name := range capabilityList {
+		caps = append(caps, name)
+	}
+	return caps
+}
+
+// 根据--cap-add, --cap-drop和--privileged计算容器的capability集合
+func GetCapabilities(capAdd []string, capDrop []string, privileged bool) ([]string, error) {
+	if privileged {
+		caps := allCapabilities()
+		sort.Slice(caps, func(i, j int) bool { return capabilityList[caps[i]] < capabilityList[caps[j]] })
+		return caps, nil
+	}
+	capSet := map[string]bool{}
+	for _, c := range DefaultCapabilities {
+		capSet[c] = true
+	}
+	for _, c := range capDrop {
+		name, err := normalizeCapability(c)
+		if err != nil {
+			return nil, err
+		}
+		if name == "ALL" {
+			capSet = map[string]bool{}
+			continue
+		}
+		delete(capSet, name)
+	}
+	for _, c := range capAdd {
+		name, err := normalizeCapability(c)
+		if err != nil {
+			return nil, err
+		}
+		if name == "ALL" {
+			for _, all := range allCapabilities() {
+				capSet[all] = true
+			}
+			continue
+		}
+		capSet[name] = true
+	}
+	var caps []string
+	for name := range capSet {
+		caps = append(caps, name)
+	}
+	sort.Slice(caps, func(i, j int) bool { return capabilityList[caps[i]] < capabilityList[caps[j]] })
+	return caps, nil
+}
+
+// 读取内核支持的最大capability编号
+func lastCap() (uint, error) {
+	content, err := ioutil.ReadFile(capLastCapPath)
+	if err != nil {
+		return 0, err
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, err
+	}
+	return uint(last), nil
+}
+
+// 转换为编号, 忽略内核不支持的capability
+func capabilityNumbers(caps []string) (map[uint]bool, uint, error) {
+	last, err := lastCap()
+	if err != nil {
+		return nil, 0, fmt.Errorf("read %s error %v", capLastCapPath, err)
+	}
+	keep := map[uint]bool{}
+	for _, name := range caps {
+		if c, ok := capabilityList[name]; ok && c <= last {
+			keep[c] = true
+		}
+	}
+	return keep, last, nil
+}
+
+// 丢弃bounding集合中不需要的capability, 丢弃之后无法再获得
+// 需要CAP_SETPCAP, 所以要在切换用户之前执行
+func dropBoundingSet(caps []string) error {
+	keep, last, err := capabilityNumbers(caps)
+	if err != nil {
+		return err
+	}
+	for c := uint(0); c <= last; c++ {
+		if keep[c] {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			return fmt.Errorf("drop bounding capability %d error %v", c, err)
+		}
+	}
+	return nil
+}
+
+// 设置当前线程的effective, permitted, inheritable和ambient集合
+// capability是线程属性, 调用方需要保证之后在同一个线程上exec
+// 非root用户不设置ambient集合, exec之后不再拥有capability
+func applyCapabilities(caps []string, ambient bool) error {
+	keep, _, err := capabilityNumbers(caps)
+	if err != nil {
+		return err
+	}
+
+	// effective, permitted, inheritable
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	for c := range keep {
+		data[c/32].Effective |= 1 << (c % 32)
+		data[c/32].Permitted |= 1 << (c % 32)
+		data[c/32].Inheritable |= 1 << (c % 32)
+	}
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("capset error %v", err)
+	}
+
+	// ambient
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("clear ambient capabilities error %v", err)
+	}
+	if !ambient {
+		return nil
+	}
+	for c := range keep {
+		if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c), 0, 0); err != nil {
+			return fmt.Errorf("raise ambient capability %d error %v", c, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package container
+
+import (
+	"testing"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	caps, err := GetCapabilities([]string{"net_admin"}, []string{"CAP_MKNOD", "chown"}, false)
+	if err != nil {
+		t.Fatalf("get capabilities error %v", err)
+	}
+	capSet := map[string]bool{}
+	for _, c := range caps {
+		capSet[c] = true
+	}
+	if !capSet["CAP_NET_ADMIN"] {
+		t.Errorf("CAP_NET_ADMIN should be added: %v", caps)
+	}
+	if capSet["CAP_MKNOD"] || capSet["CAP_CHOWN"] {
+		t.Errorf("CAP_MKNOD and CAP_CHOWN should be dropped: %v", caps)
+	}
+	if len(caps) != len(DefaultCapabilities)-1 {
+		t.Errorf("unexpected capabilities count %d: %v", len(caps), caps)
+	}
+
+	caps, err = GetCapabilities([]string{"kill"}, []string{"all"}, false)
+	if err != nil {
+		t.Fatalf("get capabilities error %v", err)
+	}
+	if len(caps) != 1 || caps[0] != "CAP_KILL" {
+		t.Errorf("expect only CAP_KILL, got %v", caps)
+	}
+
+	if _, err := GetCapabilities([]string{"CAP_FOO"}, nil, false); err == nil {
+		t.Errorf("unknown capability should fail")
+	}
+
+	caps, _ = GetCapabilities(nil, nil, true)
+	if len(caps) != len(capabilityList) {
+		t.Errorf("privileged container should have all capabilities: %v", caps)
+	}
+}
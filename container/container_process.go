@@ -2,6 +2,7 @@ package container
 
 import (
 	"fmt"
+	"minidocker/cgroups/subsystems"
 	"os"
 	"os/exec"
 	"syscall"
@@ -10,14 +11,73 @@ import (
 )
 
 type ContainerInfo struct {
-	Pid        string `json:"pid"`
-	Id         string `json:"id"`
-	Name       string `json:"name"`
-	Command    string `json:"command"`
-	CreateTime string `json:"createTime"`
-	Status     string `json:"status"`
-	Volume     string `json:"volume"`
-  PortMapping []string `json:"portmapping"`
+	Pid         string   `json:"pid"`
+	Id          string   `json:"id"`
+	Name        string   `json:"name"`
+	Command     string   `json:"command"`
+	CreateTime  string   `json:"createTime"`
+	Status      string   `json:"status"`
+	Volume      string   `json:"volume"`
+	PortMapping []string `json:"portmapping"`
+	IPAddress   string   `json:"ip"`
+	IPv6Address string   `json:"ip6,omitempty"`
+	MacAddress  string   `json:"mac,omitempty"`
+	// 发布到宿主机的端口, 随机端口已经分配
+	Ports []PortBinding `json:"ports,omitempty"`
+	// 容器连接的各个网络中的地址, 上面的地址为第一个网络的地址
+	Networks map[string]*NetworkSettings `json:"networks,omitempty"`
+	// 容器中有进程被oom killer杀死
+	OOMKilled  bool        `json:"oomKilled"`
+	HostConfig *HostConfig `json:"hostConfig"`
+}
+
+// 容器在一个网络中的接口和地址
+type NetworkSettings struct {
+	Interface   string `json:"interface"`
+	IPAddress   string `json:"ip,omitempty"`
+	IPv6Address string `json:"ip6,omitempty"`
+	MacAddress  string `json:"mac"`
+}
+
+// 容器运行配置: 主机名, DNS, 设备, 用户, 资源限制, capability, seccomp等
+type HostConfig struct {
+	Hostname   string   `json:"hostname"`
+	Domainname string   `json:"domainname"`
+	ExtraHosts []string `json:"extraHosts"`
+	Dns        []string `json:"dns"`
+	DnsSearch  []string `json:"dnsSearch"`
+	Devices    []Device `json:"devices"`
+	CapAdd     []string `json:"capAdd"`
+	CapDrop    []string `json:"capDrop"`
+	Privileged bool     `json:"privileged"`
+	// 最终生效的capability集合
+	Capabilities    []string `json:"capabilities"`
+	SecurityOpt     []string `json:"securityOpt"`
+	SeccompProfile  string   `json:"seccompProfile"`
+	NoNewPrivileges bool     `json:"noNewPrivileges"`
+	ReadonlyRootfs  bool     `json:"readonlyRootfs"`
+	Tmpfs           []string `json:"tmpfs"`
+	MaskedPaths     []string `json:"maskedPaths"`
+	ReadonlyPaths   []string `json:"readonlyPaths"`
+	// name|uid[:group|gid]
+	User     string   `json:"user"`
+	GroupAdd []string `json:"groupAdd"`
+	Ulimits  []Ulimit `json:"ulimits"`
+	// 使用minidocker自身作为1号进程, 转发信号并回收僵尸进程
+	Init bool `json:"init"`
+	// 容器cgroup的父路径, 可以是 minidocker.slice 这样的slice
+	CgroupParent string `json:"cgroupParent"`
+	// 内存使用量跨过这些阈值时记录事件
+	MemoryThresholds []int64 `json:"memoryThresholds"`
+	// 容器暴露的端口, -P时全部发布到随机端口
+	ExposedPorts    []string `json:"exposedPorts"`
+	PublishAllPorts bool     `json:"publishAllPorts"`
+	// 指定的静态地址, 为空时由IPAM分配
+	IPAddress   string `json:"ipAddress"`
+	IPv6Address string `json:"ipv6Address"`
+	MacAddress  string `json:"macAddress"`
+	// cgroup资源限制, update之后会同步更新
+	Resources *subsystems.ResourceConfig `json:"resources"`
 }
 
 var (
@@ -27,6 +87,11 @@ var (
 	DefaultInfoLocation string = "/var/run/minidocker/%s/"
 	ConfigName          string = "config.json"
 	ContainerLogFile    string = "container.log"
+	HostsFile           string = "hosts"
+	HostnameFile        string = "hostname"
+	ResolvConfFile      string = "resolv.conf"
+	SeccompProfileFile  string = "seccomp.json"
+	EventsFile          string = "events.json"
 
 	RootUrl       string = "/root/docker"
 	MntUrl        string = "/root/docker/mnt/%s"
@@ -46,7 +111,8 @@ func NewParentProcess(tty bool, containerName string, volume string, imageName s
 	if err != nil {
 		logrus.Errorf("New pipe error %v", err)
 	}
-	cmd := exec.Command("/proc/self/exe", "init")
+	// 容器名作为init的参数,init根据容器名读取容器配置
+	cmd := exec.Command("/proc/self/exe", "init", containerName)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID |
 			syscall.CLONE_NEWNS | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC,
@@ -73,7 +139,7 @@ func NewParentProcess(tty bool, containerName string, volume string, imageName s
 	}
 
 	cmd.ExtraFiles = []*os.File{readPipe}
-  cmd.Env = append(os.Environ(), envSlice...)
+	cmd.Env = append(os.Environ(), envSlice...)
 	NewWorkSpace(volume, containerName, imageName)
 	cmd.Dir = fmt.Sprintf(MntUrl, containerName)
 	return cmd, writePipe
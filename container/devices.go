@@ -0,0 +1,195 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"minidocker/utils"
+
+	"golang.org/x/sys/unix"
+)
+
+// 映射到容器中的设备, 对应 --device /dev/foo:/dev/bar:rwm
+type Device struct {
+	PathOnHost        string `json:"pathOnHost"`
+	PathInContainer   string `json:"pathInContainer"`
+	CgroupPermissions string `json:"cgroupPermissions"`
+}
+
+// 容器中默认创建的设备节点
+type deviceNode struct {
+	path  string
+	major uint32
+	minor uint32
+}
+
+var defaultDevices = []deviceNode{
+	{path: "/dev/null", major: 1, minor: 3},
+	{path: "/dev/zero", major: 1, minor: 5},
+	{path: "/dev/full", major: 1, minor: 7},
+	{path: "/dev/random", major: 1, minor: 8},
+	{path: "/dev/urandom", major: 1, minor: 9},
+	{path: "/dev/tty", major: 5, minor: 0},
+}
+
+// /dev下的默认符号链接
+var defaultDevSymlinks = [][2]string{
+	{"/proc/self/fd", "/dev/fd"},
+	{"/proc/self/fd/0", "/dev/stdin"},
+	{"/proc/self/fd/1", "/dev/stdout"},
+	{"/proc/self/fd/2", "/dev/stderr"},
+	{"pts/ptmx", "/dev/ptmx"},
+}
+
+// 解析--device参数, 格式为 hostPath[:containerPath][:permissions]
+func ParseDevice(device string) (*Device, error) {
+	parts := strings.Split(device, ":")
+	d := &Device{
+		CgroupPermissions: "rwm",
+	}
+	switch len(parts) {
+	case 3:
+		d.CgroupPermissions = parts[2]
+		d.PathInContainer = parts[1]
+	case 2:
+		if validDevicePermissions(parts[1]) {
+			d.CgroupPermissions = parts[1]
+		} else {
+			d.PathInContainer = parts[1]
+		}
+	case 1:
+	default:
+		return nil, fmt.Errorf("invalid device specification: %s", device)
+	}
+	d.PathOnHost = parts[0]
+	if d.PathInContainer == "" {
+		d.PathInContainer = d.PathOnHost
+	}
+	if !filepath.IsAbs(d.PathOnHost) || !filepath.IsAbs(d.PathInContainer) {
+		return nil, fmt.Errorf("device path must be absolute: %s", device)
+	}
+	if !validDevicePermissions(d.CgroupPermissions) {
+		return nil, fmt.Errorf("invalid device permissions %s", d.CgroupPermissions)
+	}
+	return d, nil
+}
+
+func validDevicePermissions(perms string) bool {
+	if perms == "" {
+		return false
+	}
+	for _, c := range perms {
+		if c != 'r' && c != 'w' && c != 'm' {
+			return false
+		}
+	}
+	return true
+}
+
+// 读取宿主机设备的类型和设备号
+func (d *Device) stat() (*unix.Stat_t, error) {
+	var stat unix.Stat_t
+	if err := unix.Stat(d.PathOnHost, &stat); err != nil {
+		return nil, fmt.Errorf("stat device %s error %v", d.PathOnHost, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFCHR && stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return nil, fmt.Errorf("%s is not a device", d.PathOnHost)
+	}
+	return &stat, nil
+}
+
+// 转换为devices cgroup的规则, 如 "c 10:200 rwm"
+func (d *Device) CgroupRule() (string, error) {
+	stat, err := d.stat()
+	if err != nil {
+		return "", err
+	}
+	devType := "c"
+	if stat.Mode&unix.S_IFMT == unix.S_IFBLK {
+		devType = "b"
+	}
+	return fmt.Sprintf("%s %d:%d %s", devType, unix.Major(stat.Rdev), unix.Minor(stat.Rdev), d.CgroupPermissions), nil
+}
+
+// 在rootfs的/dev上挂载tmpfs并创建设备节点, devpts, shm和符号链接
+// 需要在pivotRoot之前执行, 以便在无法mknod时从宿主机bind mount设备
+func setUpDev(rootfs string, devices []Device) error {
+	devDir := filepath.Join(rootfs, "dev")
+	if err := os.MkdirAll(devDir, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", devDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755"); err != nil {
+		return fmt.Errorf("mount /dev error %v", err)
+	}
+
+	for _, node := range defaultDevices {
+		if err := createDeviceNode(rootfs, node.path, node.path, unix.S_IFCHR|0666, unix.Mkdev(node.major, node.minor)); err != nil {
+			return err
+		}
+	}
+	for _, d := range devices {
+		stat, err := d.stat()
+		if err != nil {
+			return err
+		}
+		if err := createDeviceNode(rootfs, d.PathOnHost, d.PathInContainer, stat.Mode, stat.Rdev); err != nil {
+			return err
+		}
+	}
+
+	// devpts
+	ptsDir := filepath.Join(devDir, "pts")
+	if err := os.MkdirAll(ptsDir, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("devpts", ptsDir, "devpts", syscall.MS_NOSUID|syscall.MS_NOEXEC,
+		"newinstance,ptmxmode=0666,mode=0620,gid=5"); err != nil {
+		return fmt.Errorf("mount /dev/pts error %v", err)
+	}
+	// shm
+	shmDir := filepath.Join(devDir, "shm")
+	if err := os.MkdirAll(shmDir, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("shm", shmDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NOEXEC|syscall.MS_NODEV,
+		"mode=1777,size=65536k"); err != nil {
+		return fmt.Errorf("mount /dev/shm error %v", err)
+	}
+
+	for _, link := range defaultDevSymlinks {
+		if err := os.Symlink(link[0], filepath.Join(rootfs, link[1])); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("symlink %s to %s error %v", link[0], link[1], err)
+		}
+	}
+	return nil
+}
+
+// 创建设备节点, 没有权限mknod时(如user namespace中)改为bind mount宿主机的设备
+func createDeviceNode(rootfs string, hostPath string, containerPath string, mode uint32, dev uint64) error {
+	dst := filepath.Join(rootfs, containerPath)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := unix.Mknod(dst, mode, int(dev))
+	if err == nil {
+		// mknod受umask影响, 需要重新设置权限
+		return unix.Chmod(dst, mode&0777)
+	}
+	if err != unix.EPERM {
+		return fmt.Errorf("mknod %s error %v", dst, err)
+	}
+	if !utils.PathExists(dst) {
+		f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("create %s error %v", dst, err)
+		}
+		f.Close()
+	}
+	if err := syscall.Mount(hostPath, dst, "bind", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind mount %s to %s error %v", hostPath, dst, err)
+	}
+	return nil
+}
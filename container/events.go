@@ -0,0 +1,67 @@
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 容器事件类型
+const (
+	EventOOM             = "oom"
+	EventOOMKill         = "oom_kill"
+	EventMemoryThreshold = "memory_threshold"
+)
+
+// 容器事件, 按行追加到容器信息目录下的events.json
+type Event struct {
+	Time    string `json:"time"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// 追加一条容器事件
+func AppendEvent(containerName string, eventType string, message string) error {
+	eventsFile := fmt.Sprintf(DefaultInfoLocation, containerName) + EventsFile
+	f, err := os.OpenFile(eventsFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open %s error %v", eventsFile, err)
+	}
+	defer f.Close()
+	content, err := json.Marshal(&Event{
+		Time:    time.Now().Format(time.RFC3339),
+		Type:    eventType,
+		Message: message,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(content, '\n'))
+	return err
+}
+
+// 读取容器的所有事件, 没有事件时返回空
+func ReadEvents(containerName string) ([]Event, error) {
+	eventsFile := fmt.Sprintf(DefaultInfoLocation, containerName) + EventsFile
+	f, err := os.Open(eventsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
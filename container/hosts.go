@@ -0,0 +1,202 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"minidocker/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+const hostResolvConf = "/etc/resolv.conf"
+
+// 宿主机resolv.conf中只有本地回环的nameserver时使用的默认DNS
+var defaultDns = []string{"8.8.8.8", "8.8.4.4"}
+
+// 解析--add-host参数, 格式为 host:ip
+func ParseExtraHost(extraHost string) (string, net.IP, error) {
+	hostIP := strings.SplitN(extraHost, ":", 2)
+	if len(hostIP) != 2 || hostIP[0] == "" {
+		return "", nil, fmt.Errorf("invalid extra host %s, format should be host:ip", extraHost)
+	}
+	ip := net.ParseIP(hostIP[1])
+	if ip == nil {
+		return "", nil, fmt.Errorf("invalid ip address %s in extra host %s", hostIP[1], extraHost)
+	}
+	return hostIP[0], ip, nil
+}
+
+// 生成容器的hosts, hostname, resolv.conf文件, 存放在容器信息目录下
+// init进程在setUpMount时将这些文件挂载到容器的/etc中
+func CreateHostFiles(containerName string, hostConfig *HostConfig, ip net.IP) error {
+	dirURL := fmt.Sprintf(DefaultInfoLocation, containerName)
+	if err := os.MkdirAll(dirURL, 0622); err != nil {
+		return fmt.Errorf("mkdir %s error %v", dirURL, err)
+	}
+
+	hostname := hostConfig.Hostname
+	if err := ioutil.WriteFile(dirURL+HostnameFile, []byte(hostname+"\n"), 0644); err != nil {
+		return fmt.Errorf("write hostname file error %v", err)
+	}
+
+	hosts, err := buildHosts(hostConfig, ip)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dirURL+HostsFile, hosts, 0644); err != nil {
+		return fmt.Errorf("write hosts file error %v", err)
+	}
+
+	resolvConf, err := buildResolvConf(hostConfig)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dirURL+ResolvConfFile, resolvConf, 0644); err != nil {
+		return fmt.Errorf("write resolv.conf file error %v", err)
+	}
+	return nil
+}
+
+func buildHosts(hostConfig *HostConfig, ip net.IP) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("127.0.0.1\tlocalhost\n")
+	buf.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	buf.WriteString("fe00::0\tip6-localnet\n")
+	buf.WriteString("ff00::0\tip6-mcastprefix\n")
+	buf.WriteString("ff02::1\tip6-allnodes\n")
+	buf.WriteString("ff02::2\tip6-allrouters\n")
+	// 容器自身的地址
+	if ip != nil && hostConfig.Hostname != "" {
+		if hostConfig.Domainname != "" {
+			fmt.Fprintf(&buf, "%s\t%s.%s %s\n", ip, hostConfig.Hostname, hostConfig.Domainname, hostConfig.Hostname)
+		} else {
+			fmt.Fprintf(&buf, "%s\t%s\n", ip, hostConfig.Hostname)
+		}
+	}
+	for _, extraHost := range hostConfig.ExtraHosts {
+		host, hostIP, err := ParseExtraHost(extraHost)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s\t%s\n", hostIP, host)
+	}
+	return buf.Bytes(), nil
+}
+
+func buildResolvConf(hostConfig *HostConfig) ([]byte, error) {
+	nameservers := hostConfig.Dns
+	search := hostConfig.DnsSearch
+	var options []string
+
+	// 没有指定DNS时沿用宿主机的配置
+	if len(nameservers) == 0 || len(search) == 0 {
+		hostNameservers, hostSearch, hostOptions := readHostResolvConf()
+		if len(nameservers) == 0 {
+			nameservers = hostNameservers
+			options = hostOptions
+		}
+		if len(search) == 0 {
+			search = hostSearch
+		}
+	}
+	if len(nameservers) == 0 {
+		nameservers = defaultDns
+	}
+
+	var buf bytes.Buffer
+	if len(search) > 0 {
+		fmt.Fprintf(&buf, "search %s\n", strings.Join(search, " "))
+	}
+	for _, ns := range nameservers {
+		if net.ParseIP(ns) == nil {
+			return nil, fmt.Errorf("invalid dns server %s", ns)
+		}
+		fmt.Fprintf(&buf, "nameserver %s\n", ns)
+	}
+	if len(options) > 0 {
+		fmt.Fprintf(&buf, "options %s\n", strings.Join(options, " "))
+	}
+	return buf.Bytes(), nil
+}
+
+// 读取宿主机的resolv.conf
+// 容器有独立的网络namespace, 宿主机上本地回环的nameserver在容器中不可达, 需要过滤掉
+func readHostResolvConf() (nameservers []string, search []string, options []string) {
+	f, err := os.Open(hostResolvConf)
+	if err != nil {
+		logrus.Warnf("open %s error %v", hostResolvConf, err)
+		return nil, nil, nil
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			ip := net.ParseIP(fields[1])
+			if ip == nil || ip.IsLoopback() {
+				continue
+			}
+			nameservers = append(nameservers, fields[1])
+		case "search", "domain":
+			search = fields[1:]
+		case "options":
+			options = append(options, fields[1:]...)
+		}
+	}
+	return nameservers, search, options
+}
+
+// 将容器信息目录下的hosts, hostname, resolv.conf挂载到容器rootfs的/etc中
+func mountHostFiles(rootfs string, containerName string) error {
+	dirURL := fmt.Sprintf(DefaultInfoLocation, containerName)
+	for _, name := range []string{HostsFile, HostnameFile, ResolvConfFile} {
+		src := dirURL + name
+		if !utils.PathExists(src) {
+			continue
+		}
+		dst := filepath.Join(rootfs, "etc", name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("mkdir %s error %v", filepath.Dir(dst), err)
+		}
+		// bind mount的目标文件必须存在
+		if !utils.PathExists(dst) {
+			f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return fmt.Errorf("create %s error %v", dst, err)
+			}
+			f.Close()
+		}
+		if err := syscall.Mount(src, dst, "bind", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind mount %s to %s error %v", src, dst, err)
+		}
+	}
+	return nil
+}
+
+// 在容器的UTS namespace中设置主机名和域名
+func setHostname(hostConfig *HostConfig) error {
+	if hostConfig.Hostname != "" {
+		if err := syscall.Sethostname([]byte(hostConfig.Hostname)); err != nil {
+			return fmt.Errorf("set hostname %s error %v", hostConfig.Hostname, err)
+		}
+	}
+	if hostConfig.Domainname != "" {
+		if err := syscall.Setdomainname([]byte(hostConfig.Domainname)); err != nil {
+			return fmt.Errorf("set domainname %s error %v", hostConfig.Domainname, err)
+		}
+	}
+	return nil
+}
@@ -1,11 +1,13 @@
 package container
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 
@@ -25,13 +27,50 @@ func readUserCommand() []string {
 	return strings.Split(msgStr, " ")
 }
 
-func RunContainerInitProcess() error {
+// 读取父进程记录的容器信息
+func loadContainerInfo(containerName string) (*ContainerInfo, error) {
+	configFilePath := fmt.Sprintf(DefaultInfoLocation, containerName) + ConfigName
+	contentBytes, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var containerInfo ContainerInfo
+	if err := json.Unmarshal(contentBytes, &containerInfo); err != nil {
+		return nil, err
+	}
+	if containerInfo.HostConfig == nil {
+		containerInfo.HostConfig = &HostConfig{}
+	}
+	return &containerInfo, nil
+}
+
+func RunContainerInitProcess(containerName string) error {
+	// capability等属性是线程级别的, 设置和exec需要在同一个线程上
+	runtime.LockOSThread()
+
 	cmdArr := readUserCommand()
 	if len(cmdArr) == 0 {
 		return fmt.Errorf("run container get user command error, cmdArr is nil")
 	}
+	// 父进程在关闭管道前已经记录好容器信息
+	containerInfo, err := loadContainerInfo(containerName)
+	if err != nil {
+		logrus.Errorf("load container %s info error %v", containerName, err)
+		return err
+	}
+	// profile在宿主机的容器信息目录下, 需要在pivotRoot之前读取
+	seccompFilter, err := loadSeccompFilter(containerInfo)
+	if err != nil {
+		logrus.Errorf("load seccomp profile error %v", err)
+		return err
+	}
 
-	setUpMount()
+	setUpMount(containerInfo)
+
+	if err := setHostname(containerInfo.HostConfig); err != nil {
+		logrus.Errorf("set hostname error %v", err)
+		return err
+	}
 
 	path, err := exec.LookPath(cmdArr[0])
 	if err != nil {
@@ -39,6 +78,42 @@ func RunContainerInitProcess() error {
 		return err
 	}
 	logrus.Infof("Find path %s", path)
+
+	// 从容器的rootfs中解析用户
+	execUser, err := GetExecUser(containerInfo.HostConfig.User, containerInfo.HostConfig.GroupAdd, "/")
+	if err != nil {
+		logrus.Errorf("get exec user error %v", err)
+		return err
+	}
+	if err := os.Setenv("HOME", execUser.Home); err != nil {
+		return err
+	}
+	if err := setRlimits(containerInfo.HostConfig.Ulimits); err != nil {
+		logrus.Errorf("set rlimits error %v", err)
+		return err
+	}
+	// bounding集合需要在切换用户之前设置
+	caps := containerInfo.HostConfig.Capabilities
+	if err := dropBoundingSet(caps); err != nil {
+		logrus.Errorf("drop bounding capabilities error %v", err)
+		return err
+	}
+	if err := setupUser(execUser); err != nil {
+		logrus.Errorf("setup user error %v", err)
+		return err
+	}
+	if err := applyCapabilities(caps, execUser.Uid == 0); err != nil {
+		logrus.Errorf("apply capabilities error %v", err)
+		return err
+	}
+	if err := applySecurity(containerInfo.HostConfig, seccompFilter); err != nil {
+		logrus.Errorf("apply seccomp error %v", err)
+		return err
+	}
+	if containerInfo.HostConfig.Init {
+		// 保持当前进程为1号进程
+		return forkAndReap(path, cmdArr[0:], os.Environ())
+	}
 	if err := syscall.Exec(path, cmdArr[0:], os.Environ()); err != nil {
 		logrus.Errorf(err.Error())
 	}
@@ -46,33 +121,45 @@ func RunContainerInitProcess() error {
 }
 
 // mount init
-func setUpMount() {
+func setUpMount(containerInfo *ContainerInfo) {
 	// get current path
 	pwd, err := os.Getwd()
 	if err != nil {
 		logrus.Errorf("Get current location error %v", err)
 		os.Exit(1)
 	}
-	if err := pivotRoot(pwd); err != nil {
-		logrus.Errorf("pivotRoot exec failed! %v", err)
-		os.Exit(1)
-	}
-
-	// mount proc
 	// systemd 加入linux后 mount namespace 需要变成 shared by default
 	// 所以必须显式声明要这个新的mount namespace 独立
+	// 需要在挂载hosts等文件之前执行, 否则挂载会传播到宿主机
 	if err := syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
 		logrus.Errorf("mount / failed! %v", err)
 		os.Exit(1)
 	}
+	// hosts, hostname, resolv.conf
+	if err := mountHostFiles(pwd, containerInfo.Name); err != nil {
+		logrus.Errorf("mount host files failed! %v", err)
+		os.Exit(1)
+	}
+	// /dev
+	if err := setUpDev(pwd, containerInfo.HostConfig.Devices); err != nil {
+		logrus.Errorf("set up /dev failed! %v", err)
+		os.Exit(1)
+	}
+	if err := pivotRoot(pwd); err != nil {
+		logrus.Errorf("pivotRoot exec failed! %v", err)
+		os.Exit(1)
+	}
+
+	// mount proc
 	defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
 	if err := syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), ""); err != nil {
 		logrus.Errorf("mount /proc failed! %v", err)
 		os.Exit(1)
 	}
 
-	if err := syscall.Mount("tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755"); err != nil {
-		logrus.Errorf("mount /dev failed! %v", err)
+	// sysfs, tmpfs, 屏蔽和只读路径, 只读rootfs
+	if err := setUpRootfsProtection(containerInfo.HostConfig); err != nil {
+		logrus.Errorf("set up rootfs protection failed! %v", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,243 @@
+package container
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// 发布到宿主机的端口, HostIP为空时监听所有地址
+type PortBinding struct {
+	HostIP        string `json:"hostIp"`
+	HostPort      int    `json:"hostPort"`
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+	// 只指定了宿主机端口范围时, 从HostPort到hostPortEnd中选择一个可用端口
+	hostPortEnd int
+}
+
+func (b PortBinding) String() string {
+	hostIP := b.HostIP
+	if hostIP == "" {
+		hostIP = "0.0.0.0"
+	}
+	return fmt.Sprintf("%d/%s -> %s", b.ContainerPort, b.Protocol, net.JoinHostPort(hostIP, strconv.Itoa(b.HostPort)))
+}
+
+// 解析端口或端口范围, 如 80 或 8000-8010
+func parsePortRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil || start < 1 || start > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %s", s)
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil || end < start || end > 65535 {
+			return 0, 0, fmt.Errorf("invalid port range %s", s)
+		}
+	}
+	return start, end, nil
+}
+
+// 拆分协议, 默认为tcp
+func splitProtocol(spec string) (string, string, error) {
+	proto := "tcp"
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		spec, proto = spec[:i], strings.ToLower(spec[i+1:])
+	}
+	if proto != "tcp" && proto != "udp" {
+		return "", "", fmt.Errorf("invalid protocol %s, must be tcp or udp", proto)
+	}
+	return spec, proto, nil
+}
+
+// 解析端口发布参数 [hostIP:][hostPort[-range]:]containerPort[-range][/tcp|udp]
+// 没有指定宿主机端口时HostPort为0, 由AllocateHostPorts分配
+func ParsePortSpec(spec string) ([]PortBinding, error) {
+	rest, proto, err := splitProtocol(spec)
+	if err != nil {
+		return nil, err
+	}
+	hostIP, hostPort, containerPort := "", "", rest
+	if strings.HasPrefix(rest, "[") {
+		// ipv6地址用[]包裹, 之后必须是 hostPort:containerPort
+		end := strings.Index(rest, "]:")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid port spec %s", spec)
+		}
+		parts := strings.Split(rest[end+2:], ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid port spec %s", spec)
+		}
+		hostIP, hostPort, containerPort = rest[1:end], parts[0], parts[1]
+	} else {
+		parts := strings.Split(rest, ":")
+		switch len(parts) {
+		case 1:
+		case 2:
+			hostPort, containerPort = parts[0], parts[1]
+		case 3:
+			hostIP, hostPort, containerPort = parts[0], parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("invalid port spec %s", spec)
+		}
+	}
+	if hostIP != "" && net.ParseIP(hostIP) == nil {
+		return nil, fmt.Errorf("invalid host ip %s in port spec %s", hostIP, spec)
+	}
+	cStart, cEnd, err := parsePortRange(containerPort)
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings []PortBinding
+	if hostPort == "" {
+		for port := cStart; port <= cEnd; port++ {
+			bindings = append(bindings, PortBinding{HostIP: hostIP, ContainerPort: port, Protocol: proto})
+		}
+		return bindings, nil
+	}
+	hStart, hEnd, err := parsePortRange(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	// 单个容器端口对应宿主机端口范围时, 从范围中选择一个可用端口
+	if cStart == cEnd && hStart != hEnd {
+		return []PortBinding{{HostIP: hostIP, HostPort: hStart, ContainerPort: cStart, Protocol: proto, hostPortEnd: hEnd}}, nil
+	}
+	if hEnd-hStart != cEnd-cStart {
+		return nil, fmt.Errorf("invalid port spec %s, host and container port ranges must have the same size", spec)
+	}
+	for i := 0; i <= cEnd-cStart; i++ {
+		bindings = append(bindings, PortBinding{HostIP: hostIP, HostPort: hStart + i, ContainerPort: cStart + i, Protocol: proto})
+	}
+	return bindings, nil
+}
+
+// 解析容器暴露的端口 port[-range][/tcp|udp], -P时发布到随机端口
+func ParseExposedPort(spec string) ([]PortBinding, error) {
+	rest, proto, err := splitProtocol(spec)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := parsePortRange(rest)
+	if err != nil {
+		return nil, err
+	}
+	var bindings []PortBinding
+	for port := start; port <= end; port++ {
+		bindings = append(bindings, PortBinding{ContainerPort: port, Protocol: proto})
+	}
+	return bindings, nil
+}
+
+// 端口是否可以在宿主机上监听
+func hostPortFree(proto, hostIP string, port int) bool {
+	addr := net.JoinHostPort(hostIP, strconv.Itoa(port))
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// 由内核分配一个空闲的临时端口
+func randomHostPort(proto, hostIP string) (int, error) {
+	addr := net.JoinHostPort(hostIP, "0")
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// 两个绑定是否占用同一个宿主机端口, 未指定地址时与所有地址冲突
+func (b PortBinding) conflicts(other PortBinding) bool {
+	if b.HostPort != other.HostPort || b.Protocol != other.Protocol {
+		return false
+	}
+	ip, otherIP := net.ParseIP(b.HostIP), net.ParseIP(other.HostIP)
+	if ip == nil || otherIP == nil || ip.IsUnspecified() || otherIP.IsUnspecified() {
+		return true
+	}
+	return ip.Equal(otherIP)
+}
+
+// 为没有指定宿主机端口的绑定分配端口, used为其他容器已经发布的端口
+func AllocateHostPorts(bindings []PortBinding, used []PortBinding) ([]PortBinding, error) {
+	allocated := append([]PortBinding{}, used...)
+	inUse := func(b PortBinding) bool {
+		for _, a := range allocated {
+			if a.conflicts(b) {
+				return true
+			}
+		}
+		return false
+	}
+	result := make([]PortBinding, 0, len(bindings))
+	for _, b := range bindings {
+		switch {
+		case b.HostPort == 0:
+			// 内核分配的端口可能已经被其他容器发布, 重试几次
+			for i := 0; i < 10; i++ {
+				port, err := randomHostPort(b.Protocol, b.HostIP)
+				if err != nil {
+					return nil, err
+				}
+				if b.HostPort = port; !inUse(b) {
+					break
+				}
+				b.HostPort = 0
+			}
+			if b.HostPort == 0 {
+				return nil, fmt.Errorf("no available host port for %d/%s", b.ContainerPort, b.Protocol)
+			}
+		case b.hostPortEnd > b.HostPort:
+			start, end := b.HostPort, b.hostPortEnd
+			b.HostPort = 0
+			for port := start; port <= end; port++ {
+				candidate := b
+				candidate.HostPort = port
+				if !inUse(candidate) && hostPortFree(b.Protocol, b.HostIP, port) {
+					b.HostPort = port
+					break
+				}
+			}
+			if b.HostPort == 0 {
+				return nil, fmt.Errorf("no available host port in range %d-%d/%s", start, end, b.Protocol)
+			}
+			b.hostPortEnd = 0
+		default:
+			if inUse(b) {
+				return nil, fmt.Errorf("host port %d/%s is already allocated", b.HostPort, b.Protocol)
+			}
+			// 宿主机上的其他进程可能已经在监听该端口
+			if !hostPortFree(b.Protocol, b.HostIP, b.HostPort) {
+				return nil, fmt.Errorf("host port %d/%s is already in use", b.HostPort, b.Protocol)
+			}
+		}
+		allocated = append(allocated, b)
+		result = append(result, b)
+	}
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package container
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	cases := []struct {
+		spec string
+		want []PortBinding
+	}{
+		{"8080:80", []PortBinding{{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}},
+		{"80", []PortBinding{{ContainerPort: 80, Protocol: "tcp"}}},
+		{"53:53/udp", []PortBinding{{HostPort: 53, ContainerPort: 53, Protocol: "udp"}}},
+		{"127.0.0.1:8080:80", []PortBinding{{HostIP: "127.0.0.1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}},
+		{"127.0.0.1::80", []PortBinding{{HostIP: "127.0.0.1", ContainerPort: 80, Protocol: "tcp"}}},
+		{"[::1]:8080:80", []PortBinding{{HostIP: "::1", HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}},
+		{"8000-8001:80-81/udp", []PortBinding{
+			{HostPort: 8000, ContainerPort: 80, Protocol: "udp"},
+			{HostPort: 8001, ContainerPort: 81, Protocol: "udp"},
+		}},
+		{"8000-8010:80", []PortBinding{{HostPort: 8000, ContainerPort: 80, Protocol: "tcp", hostPortEnd: 8010}}},
+	}
+	for _, c := range cases {
+		got, err := ParsePortSpec(c.spec)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expect %+v, got %+v", c.spec, c.want, got)
+		}
+	}
+
+	for _, spec := range []string{"", "0:80", "8080:70000", "80/sctp", "8000-8002:80-81", "a:b:c:d", "1.2.3:80:80", "[::1:80"} {
+		if _, err := ParsePortSpec(spec); err == nil {
+			t.Errorf("%s: expect error", spec)
+		}
+	}
+}
+
+func TestAllocateHostPorts(t *testing.T) {
+	bindings := []PortBinding{
+		{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		{HostIP: "127.0.0.1", ContainerPort: 53, Protocol: "udp"},
+	}
+	got, err := AllocateHostPorts(bindings, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].HostPort != 8080 || got[1].HostPort == 0 {
+		t.Errorf("unexpected bindings %+v", got)
+	}
+
+	if _, err := AllocateHostPorts(bindings[:1], []PortBinding{{HostPort: 8080, Protocol: "tcp"}}); err == nil {
+		t.Errorf("expect error allocating used port")
+	}
+	// 范围中已被使用的端口被跳过
+	ranged := []PortBinding{{HostIP: "127.0.0.1", HostPort: 40000, ContainerPort: 80, Protocol: "tcp", hostPortEnd: 40001}}
+	got, err = AllocateHostPorts(ranged, []PortBinding{{HostIP: "127.0.0.1", HostPort: 40000, Protocol: "tcp"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].HostPort != 40001 {
+		t.Errorf("expect 40001, got %d", got[0].HostPort)
+	}
+
+	// 宿主机上已经被监听的端口不能再发布
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	listening := PortBinding{HostIP: "127.0.0.1", HostPort: l.Addr().(*net.TCPAddr).Port, ContainerPort: 80, Protocol: "tcp"}
+	if _, err := AllocateHostPorts([]PortBinding{listening}, nil); err == nil {
+		t.Errorf("expect error allocating listening port %d", listening.HostPort)
+	}
+}
+
+func TestPortBindingConflicts(t *testing.T) {
+	cases := []struct {
+		a, b PortBinding
+		want bool
+	}{
+		{PortBinding{HostIP: "127.0.0.1", HostPort: 8080, Protocol: "tcp"}, PortBinding{HostIP: "10.0.0.1", HostPort: 8080, Protocol: "tcp"}, false},
+		{PortBinding{HostIP: "127.0.0.1", HostPort: 8080, Protocol: "tcp"}, PortBinding{HostIP: "127.0.0.1", HostPort: 8080, Protocol: "tcp"}, true},
+		{PortBinding{HostPort: 8080, Protocol: "tcp"}, PortBinding{HostIP: "10.0.0.1", HostPort: 8080, Protocol: "tcp"}, true},
+		{PortBinding{HostIP: "::", HostPort: 8080, Protocol: "tcp"}, PortBinding{HostIP: "127.0.0.1", HostPort: 8080, Protocol: "tcp"}, true},
+		{PortBinding{HostPort: 8080, Protocol: "tcp"}, PortBinding{HostPort: 8080, Protocol: "udp"}, false},
+		{PortBinding{HostPort: 8080, Protocol: "tcp"}, PortBinding{HostPort: 8081, Protocol: "tcp"}, false},
+	}
+	for _, c := range cases {
+		if got := c.a.conflicts(c.b); got != c.want {
+			t.Errorf("%+v and %+v: expect %v, got %v", c.a, c.b, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package container
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// --init模式: 当前进程作为容器的1号进程, fork出用户命令,
+// 将收到的信号转发给用户进程, 回收所有孤儿进程, 并以用户进程的退出码退出
+// 用户, capability和seccomp已经在当前线程上设置好, fork出的子进程会继承
+func forkAndReap(path string, args []string, env []string) error {
+	// fork之前注册信号处理, 避免遗漏信号
+	signals := make(chan os.Signal, 64)
+	signal.Notify(signals)
+
+	// 用户进程放到单独的进程组, 终端产生的SIGINT等信号只发给用户进程,
+	// 不会再经过1号进程转发一次; 有终端时将该进程组设置为前台进程组
+	sys := &syscall.SysProcAttr{Setpgid: true}
+	if _, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), unix.TCGETS); err == nil {
+		sys.Foreground = true
+		sys.Ctty = int(os.Stdin.Fd())
+	}
+	pid, err := syscall.ForkExec(path, args, &syscall.ProcAttr{
+		Env:   env,
+		Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()},
+		Sys:   sys,
+	})
+	if err != nil {
+		signal.Reset()
+		return err
+	}
+
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGCHLD:
+			if exited, status := reapChildren(pid); exited {
+				os.Exit(exitCode(status))
+			}
+		case syscall.SIGURG:
+			// go runtime用于抢占调度的信号, 不需要转发
+		case syscall.SIGTTIN, syscall.SIGTTOU:
+			// 1号进程不在前台进程组时访问终端收到的信号, 转发会让用户进程停止
+		default:
+			if err := syscall.Kill(pid, sig.(syscall.Signal)); err != nil && err != syscall.ESRCH {
+				logrus.Errorf("forward signal %v to %d error %v", sig, pid, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 回收所有已经退出的子进程, 返回用户进程是否已经退出及其状态
+func reapChildren(childPid int) (bool, syscall.WaitStatus) {
+	var childStatus syscall.WaitStatus
+	childExited := false
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if pid <= 0 || err != nil {
+			return childExited, childStatus
+		}
+		if pid == childPid {
+			childExited = true
+			childStatus = status
+		}
+	}
+}
+
+// 被信号杀死时按照shell的约定返回128+信号值
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,113 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// 资源限制, -1表示不限制
+type Ulimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+var ulimitResources = map[string]int{
+	"as":         unix.RLIMIT_AS,
+	"core":       unix.RLIMIT_CORE,
+	"cpu":        unix.RLIMIT_CPU,
+	"data":       unix.RLIMIT_DATA,
+	"fsize":      unix.RLIMIT_FSIZE,
+	"locks":      unix.RLIMIT_LOCKS,
+	"memlock":    unix.RLIMIT_MEMLOCK,
+	"msgqueue":   unix.RLIMIT_MSGQUEUE,
+	"nice":       unix.RLIMIT_NICE,
+	"nofile":     unix.RLIMIT_NOFILE,
+	"nproc":      unix.RLIMIT_NPROC,
+	"rss":        unix.RLIMIT_RSS,
+	"rtprio":     unix.RLIMIT_RTPRIO,
+	"rttime":     unix.RLIMIT_RTTIME,
+	"sigpending": unix.RLIMIT_SIGPENDING,
+	"stack":      unix.RLIMIT_STACK,
+}
+
+func parseUlimitValue(value string) (int64, error) {
+	if value == "unlimited" || value == "-1" {
+		return -1, nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid ulimit value %s", value)
+	}
+	return v, nil
+}
+
+// 解析--ulimit参数, 格式为 name=soft[:hard]
+func ParseUlimit(ulimit string) (*Ulimit, error) {
+	kv := strings.SplitN(ulimit, "=", 2)
+	if len(kv) != 2 {
+		return nil, fmt.Errorf("invalid ulimit %s, format should be name=soft[:hard]", ulimit)
+	}
+	if _, ok := ulimitResources[kv[0]]; !ok {
+		return nil, fmt.Errorf("invalid ulimit type %s", kv[0])
+	}
+	limits := strings.SplitN(kv[1], ":", 2)
+	soft, err := parseUlimitValue(limits[0])
+	if err != nil {
+		return nil, err
+	}
+	hard := soft
+	if len(limits) == 2 {
+		if hard, err = parseUlimitValue(limits[1]); err != nil {
+			return nil, err
+		}
+	}
+	if hard != -1 && (soft == -1 || soft > hard) {
+		return nil, fmt.Errorf("ulimit soft limit must be less than or equal to hard limit: %s", ulimit)
+	}
+	return &Ulimit{Name: kv[0], Soft: soft, Hard: hard}, nil
+}
+
+// 合并全局默认值和容器指定的ulimit, 同名时以容器指定的为准
+func MergeUlimits(defaults []string, ulimits []string) ([]Ulimit, error) {
+	var result []Ulimit
+	index := map[string]int{}
+	for _, u := range append(append([]string{}, defaults...), ulimits...) {
+		ulimit, err := ParseUlimit(u)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[ulimit.Name]; ok {
+			result[i] = *ulimit
+			continue
+		}
+		index[ulimit.Name] = len(result)
+		result = append(result, *ulimit)
+	}
+	return result, nil
+}
+
+func rlimitValue(v int64) uint64 {
+	if v < 0 {
+		return unix.RLIM_INFINITY
+	}
+	return uint64(v)
+}
+
+// 提高hard limit需要CAP_SYS_RESOURCE, 需要在切换用户和丢弃capability之前执行
+func setRlimits(ulimits []Ulimit) error {
+	for _, u := range ulimits {
+		resource, ok := ulimitResources[u.Name]
+		if !ok {
+			return fmt.Errorf("invalid ulimit type %s", u.Name)
+		}
+		rlimit := &unix.Rlimit{Cur: rlimitValue(u.Soft), Max: rlimitValue(u.Hard)}
+		if err := unix.Setrlimit(resource, rlimit); err != nil {
+			return fmt.Errorf("setrlimit %s error %v", u.Name, err)
+		}
+	}
+	return nil
+}
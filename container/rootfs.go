@@ -0,0 +1,202 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// 默认屏蔽的内核路径, 目录挂载只读的tmpfs, 文件挂载/dev/null
+var DefaultMaskedPaths = []string{
+	"/proc/asound",
+	"/proc/acpi",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// 默认只读的内核路径
+var DefaultReadonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// tmpfs参数中的挂载标志, 值为true时设置标志, false时清除
+var tmpfsFlags = map[string]struct {
+	flag  uintptr
+	clear bool
+}{
+	"ro":     {syscall.MS_RDONLY, false},
+	"rw":     {syscall.MS_RDONLY, true},
+	"noexec": {syscall.MS_NOEXEC, false},
+	"exec":   {syscall.MS_NOEXEC, true},
+	"nosuid": {syscall.MS_NOSUID, false},
+	"suid":   {syscall.MS_NOSUID, true},
+	"nodev":  {syscall.MS_NODEV, false},
+	"dev":    {syscall.MS_NODEV, true},
+}
+
+// tmpfs文件系统自身支持的挂载参数
+var tmpfsDataOptions = []string{"size", "mode", "uid", "gid"}
+
+// 解析--tmpfs参数, 格式为 path[:options]
+// rw, noexec等转换为挂载标志, size, mode等作为tmpfs的挂载参数
+func parseTmpfs(tmpfs string) (string, uintptr, string, error) {
+	parts := strings.SplitN(tmpfs, ":", 2)
+	if !filepath.IsAbs(parts[0]) {
+		return "", 0, "", fmt.Errorf("tmpfs path must be absolute: %s", tmpfs)
+	}
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	var data []string
+	hasMode := false
+	if len(parts) == 2 && parts[1] != "" {
+		for _, opt := range strings.Split(parts[1], ",") {
+			if f, ok := tmpfsFlags[opt]; ok {
+				if f.clear {
+					flags &^= f.flag
+				} else {
+					flags |= f.flag
+				}
+				continue
+			}
+			kv := strings.SplitN(opt, "=", 2)
+			valid := false
+			for _, name := range tmpfsDataOptions {
+				if kv[0] == name && len(kv) == 2 && kv[1] != "" {
+					valid = true
+				}
+			}
+			if !valid {
+				return "", 0, "", fmt.Errorf("invalid tmpfs option %s in %s", opt, tmpfs)
+			}
+			hasMode = hasMode || kv[0] == "mode"
+			data = append(data, opt)
+		}
+	}
+	if !hasMode {
+		data = append(data, "mode=755")
+	}
+	return parts[0], flags, strings.Join(data, ","), nil
+}
+
+// 校验--tmpfs参数
+func ValidateTmpfs(tmpfs []string) error {
+	for _, t := range tmpfs {
+		if _, _, _, err := parseTmpfs(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 挂载sysfs, 非特权容器只读
+func mountSysfs(privileged bool) error {
+	if err := os.MkdirAll("/sys", 0755); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV)
+	if !privileged {
+		flags |= syscall.MS_RDONLY
+	}
+	if err := syscall.Mount("sysfs", "/sys", "sysfs", flags, ""); err != nil {
+		return fmt.Errorf("mount /sys error %v", err)
+	}
+	return nil
+}
+
+func mountTmpfs(tmpfs []string) error {
+	for _, t := range tmpfs {
+		dst, flags, data, err := parseTmpfs(t)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return fmt.Errorf("mkdir %s error %v", dst, err)
+		}
+		if err := syscall.Mount("tmpfs", dst, "tmpfs", flags, data); err != nil {
+			return fmt.Errorf("mount tmpfs %s error %v", dst, err)
+		}
+	}
+	return nil
+}
+
+// 屏蔽路径, 不存在的路径直接跳过
+func maskPaths(paths []string) error {
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if info.IsDir() {
+			err = syscall.Mount("tmpfs", p, "tmpfs", syscall.MS_RDONLY, "")
+		} else {
+			err = syscall.Mount("/dev/null", p, "bind", syscall.MS_BIND, "")
+		}
+		if err != nil {
+			return fmt.Errorf("mask path %s error %v", p, err)
+		}
+	}
+	return nil
+}
+
+// 将路径bind mount到自身后重新挂载为只读
+func readonlyPaths(paths []string) error {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := remountReadonly(p); err != nil {
+			return fmt.Errorf("readonly path %s error %v", p, err)
+		}
+	}
+	return nil
+}
+
+func remountReadonly(p string) error {
+	if err := syscall.Mount(p, p, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	return syscall.Mount(p, p, "", flags, "")
+}
+
+// pivotRoot之后对rootfs和内核路径做保护
+func setUpRootfsProtection(hostConfig *HostConfig) error {
+	if err := mountSysfs(hostConfig.Privileged); err != nil {
+		return err
+	}
+	// tmpfs需要在rootfs只读之前创建挂载点
+	if err := mountTmpfs(hostConfig.Tmpfs); err != nil {
+		return err
+	}
+	if err := maskPaths(hostConfig.MaskedPaths); err != nil {
+		return err
+	}
+	if err := readonlyPaths(hostConfig.ReadonlyPaths); err != nil {
+		return err
+	}
+	if hostConfig.ReadonlyRootfs {
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		if err := syscall.Mount("", "/", "", flags, ""); err != nil {
+			return fmt.Errorf("remount rootfs readonly error %v", err)
+		}
+	}
+	return nil
+}
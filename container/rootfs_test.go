@@ -0,0 +1,38 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseTmpfs(t *testing.T) {
+	defaultFlags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	cases := []struct {
+		tmpfs string
+		dst   string
+		flags uintptr
+		data  string
+	}{
+		{"/run", "/run", defaultFlags, "mode=755"},
+		{"/run:", "/run", defaultFlags, "mode=755"},
+		{"/run:rw,noexec,nosuid,size=64m", "/run", defaultFlags | syscall.MS_NOEXEC, "size=64m,mode=755"},
+		{"/run:ro,nodev", "/run", defaultFlags | syscall.MS_RDONLY, "mode=755"},
+		{"/tmp:exec,suid,dev,mode=1777,uid=1000,gid=1000", "/tmp", 0, "mode=1777,uid=1000,gid=1000"},
+	}
+	for _, c := range cases {
+		dst, flags, data, err := parseTmpfs(c.tmpfs)
+		if err != nil {
+			t.Errorf("%s: %v", c.tmpfs, err)
+			continue
+		}
+		if dst != c.dst || flags != c.flags || data != c.data {
+			t.Errorf("%s: expect %s %#x %q, got %s %#x %q", c.tmpfs, c.dst, c.flags, c.data, dst, flags, data)
+		}
+	}
+
+	for _, tmpfs := range []string{"run", "/run:foo", "/run:size", "/run:size=", "/run:nr_inodes=10"} {
+		if _, _, _, err := parseTmpfs(tmpfs); err == nil {
+			t.Errorf("%s: expect error", tmpfs)
+		}
+	}
+}
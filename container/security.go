@@ -0,0 +1,134 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"minidocker/seccomp"
+	"minidocker/utils"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	SeccompDefault    = "default"
+	SeccompUnconfined = "unconfined"
+)
+
+// 解析--security-opt参数, 支持
+// seccomp=profile.json|unconfined, no-new-privileges,
+// systempaths=unconfined, masked-path=/path, readonly-path=/path
+func ParseSecurityOpts(hostConfig *HostConfig) error {
+	systemPathsUnconfined := hostConfig.Privileged
+	var maskedPaths, readonlyPaths []string
+	for _, opt := range hostConfig.SecurityOpt {
+		if opt == "no-new-privileges" {
+			hostConfig.NoNewPrivileges = true
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid security option %s", opt)
+		}
+		switch kv[0] {
+		case "seccomp":
+			hostConfig.SeccompProfile = kv[1]
+		case "no-new-privileges":
+			hostConfig.NoNewPrivileges = kv[1] == "true"
+		case "systempaths":
+			if kv[1] != "unconfined" {
+				return fmt.Errorf("invalid security option %s", opt)
+			}
+			systemPathsUnconfined = true
+		case "masked-path":
+			maskedPaths = append(maskedPaths, kv[1])
+		case "readonly-path":
+			readonlyPaths = append(readonlyPaths, kv[1])
+		default:
+			return fmt.Errorf("unknown security option %s", opt)
+		}
+	}
+	// 特权容器和systempaths=unconfined时不屏蔽内核路径
+	if !systemPathsUnconfined {
+		maskedPaths = append(append([]string{}, DefaultMaskedPaths...), maskedPaths...)
+		readonlyPaths = append(append([]string{}, DefaultReadonlyPaths...), readonlyPaths...)
+	}
+	hostConfig.MaskedPaths = maskedPaths
+	hostConfig.ReadonlyPaths = readonlyPaths
+	if hostConfig.SeccompProfile == "" {
+		// 特权容器默认不启用seccomp
+		if hostConfig.Privileged {
+			hostConfig.SeccompProfile = SeccompUnconfined
+		} else {
+			hostConfig.SeccompProfile = SeccompDefault
+		}
+	}
+	// 提前编译一次, 尽早发现profile中的错误
+	content, err := readSeccompProfile(hostConfig)
+	if err != nil || content == nil {
+		return err
+	}
+	profile, err := seccomp.LoadProfile(content)
+	if err != nil {
+		return err
+	}
+	if _, err := seccomp.Compile(profile, hostConfig.Capabilities); err != nil {
+		return fmt.Errorf("compile seccomp profile %s error %v", hostConfig.SeccompProfile, err)
+	}
+	return nil
+}
+
+func readSeccompProfile(hostConfig *HostConfig) ([]byte, error) {
+	switch hostConfig.SeccompProfile {
+	case SeccompUnconfined:
+		return nil, nil
+	case SeccompDefault, "":
+		return seccomp.DefaultProfile(), nil
+	}
+	content, err := ioutil.ReadFile(hostConfig.SeccompProfile)
+	if err != nil {
+		return nil, fmt.Errorf("read seccomp profile %s error %v", hostConfig.SeccompProfile, err)
+	}
+	return content, nil
+}
+
+// 将seccomp profile保存到容器信息目录下, init进程从这里读取
+func CreateSeccompProfile(containerName string, hostConfig *HostConfig) error {
+	content, err := readSeccompProfile(hostConfig)
+	if err != nil || content == nil {
+		return err
+	}
+	profilePath := fmt.Sprintf(DefaultInfoLocation, containerName) + SeccompProfileFile
+	if err := ioutil.WriteFile(profilePath, content, 0644); err != nil {
+		return fmt.Errorf("write seccomp profile %s error %v", profilePath, err)
+	}
+	return nil
+}
+
+// 读取并编译容器的seccomp profile, 没有配置时返回nil
+func loadSeccompFilter(containerInfo *ContainerInfo) ([]unix.SockFilter, error) {
+	profilePath := fmt.Sprintf(DefaultInfoLocation, containerInfo.Name) + SeccompProfileFile
+	if !utils.PathExists(profilePath) {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(profilePath)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := seccomp.LoadProfile(content)
+	if err != nil {
+		return nil, err
+	}
+	return seccomp.Compile(profile, containerInfo.HostConfig.Capabilities)
+}
+
+// 设置no_new_privs并安装seccomp filter, 需要在exec之前最后执行
+func applySecurity(hostConfig *HostConfig, filter []unix.SockFilter) error {
+	if hostConfig.NoNewPrivileges || filter != nil {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("set no_new_privs error %v", err)
+		}
+	}
+	return seccomp.InitSeccomp(filter)
+}
@@ -0,0 +1,221 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 容器中执行命令的用户
+type ExecUser struct {
+	Uid   int
+	Gid   int
+	Sgids []int
+	Home  string
+}
+
+type passwdEntry struct {
+	name string
+	uid  int
+	gid  int
+	home string
+}
+
+type groupEntry struct {
+	name    string
+	gid     int
+	members []string
+}
+
+// 按行读取冒号分隔的文件, 文件不存在时返回空
+func readColonFile(path string, minFields int) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < minFields {
+			continue
+		}
+		lines = append(lines, fields)
+	}
+	return lines, scanner.Err()
+}
+
+// 解析 name:password:uid:gid:gecos:home:shell
+func parsePasswd(path string) ([]passwdEntry, error) {
+	lines, err := readColonFile(path, 6)
+	if err != nil {
+		return nil, err
+	}
+	var entries []passwdEntry
+	for _, fields := range lines {
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+		entries = append(entries, passwdEntry{name: fields[0], uid: uid, gid: gid, home: fields[5]})
+	}
+	return entries, nil
+}
+
+// 解析 name:password:gid:user1,user2
+func parseGroup(path string) ([]groupEntry, error) {
+	lines, err := readColonFile(path, 3)
+	if err != nil {
+		return nil, err
+	}
+	var entries []groupEntry
+	for _, fields := range lines {
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		entry := groupEntry{name: fields[0], gid: gid}
+		if len(fields) > 3 && fields[3] != "" {
+			entry.members = strings.Split(fields[3], ",")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// 按名字或者gid查找组
+func lookupGroup(groups []groupEntry, group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	for _, g := range groups {
+		if g.name == group {
+			return g.gid, nil
+		}
+	}
+	return 0, fmt.Errorf("unable to find group %s", group)
+}
+
+// 根据容器rootfs中的passwd将uid解析为用户名, 找不到时返回uid
+func LookupUserName(rootfs string, uid int) string {
+	passwd, err := parsePasswd(filepath.Join(rootfs, "etc/passwd"))
+	if err == nil {
+		for _, p := range passwd {
+			if p.uid == uid {
+				return p.name
+			}
+		}
+	}
+	return strconv.Itoa(uid)
+}
+
+// 根据 name|uid[:group|gid] 和 --group-add 解析用户
+// passwd和group文件从容器的rootfs中读取, 而不是宿主机
+func GetExecUser(userSpec string, groupAdd []string, rootfs string) (*ExecUser, error) {
+	passwd, err := parsePasswd(filepath.Join(rootfs, "etc/passwd"))
+	if err != nil {
+		return nil, fmt.Errorf("read passwd error %v", err)
+	}
+	groups, err := parseGroup(filepath.Join(rootfs, "etc/group"))
+	if err != nil {
+		return nil, fmt.Errorf("read group error %v", err)
+	}
+
+	userPart, groupPart := userSpec, ""
+	if idx := strings.Index(userSpec, ":"); idx >= 0 {
+		userPart, groupPart = userSpec[:idx], userSpec[idx+1:]
+	}
+	if userPart == "" {
+		userPart = "0"
+	}
+
+	user := &ExecUser{Home: "/"}
+	var matched *passwdEntry
+	uid, uidErr := strconv.Atoi(userPart)
+	for i := range passwd {
+		if (uidErr == nil && passwd[i].uid == uid) || (uidErr != nil && passwd[i].name == userPart) {
+			matched = &passwd[i]
+			break
+		}
+	}
+	if matched != nil {
+		user.Uid = matched.uid
+		user.Gid = matched.gid
+		user.Home = matched.home
+	} else if uidErr == nil {
+		// 数字uid可以不在passwd中
+		user.Uid = uid
+	} else {
+		return nil, fmt.Errorf("unable to find user %s", userPart)
+	}
+	if user.Uid < 0 {
+		return nil, fmt.Errorf("invalid uid %d", user.Uid)
+	}
+
+	if groupPart != "" {
+		gid, err := lookupGroup(groups, groupPart)
+		if err != nil {
+			return nil, err
+		}
+		user.Gid = gid
+	} else if matched != nil {
+		// 没有指定组时, 附加用户所属的组
+		for _, g := range groups {
+			for _, member := range g.members {
+				if member == matched.name && g.gid != user.Gid {
+					user.Sgids = append(user.Sgids, g.gid)
+				}
+			}
+		}
+	}
+	for _, group := range groupAdd {
+		gid, err := lookupGroup(groups, group)
+		if err != nil {
+			return nil, err
+		}
+		user.Sgids = append(user.Sgids, gid)
+	}
+	if user.Gid < 0 {
+		return nil, fmt.Errorf("invalid gid %d", user.Gid)
+	}
+	return user, nil
+}
+
+// 切换到指定用户, 切换后保留permitted集合, 以便之后设置capability
+func setupUser(user *ExecUser) error {
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set keep caps error %v", err)
+	}
+	if err := syscall.Setgroups(user.Sgids); err != nil {
+		return fmt.Errorf("setgroups %v error %v", user.Sgids, err)
+	}
+	if err := syscall.Setgid(user.Gid); err != nil {
+		return fmt.Errorf("setgid %d error %v", user.Gid, err)
+	}
+	if err := syscall.Setuid(user.Uid); err != nil {
+		return fmt.Errorf("setuid %d error %v", user.Uid, err)
+	}
+	if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 0, 0, 0, 0); err != nil {
+		return fmt.Errorf("clear keep caps error %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetExecUser(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	passwd := "root:x:0:0:root:/root:/bin/sh\nnginx:x:101:101:nginx:/var/lib/nginx:/sbin/nologin\n"
+	group := "root:x:0:\nnginx:x:101:\nwww:x:33:nginx\naudio:x:29:\n"
+	ioutil.WriteFile(filepath.Join(rootfs, "etc/passwd"), []byte(passwd), 0644)
+	ioutil.WriteFile(filepath.Join(rootfs, "etc/group"), []byte(group), 0644)
+
+	cases := []struct {
+		spec     string
+		groupAdd []string
+		want     ExecUser
+	}{
+		{"", nil, ExecUser{Uid: 0, Gid: 0, Home: "/root"}},
+		{"nginx", nil, ExecUser{Uid: 101, Gid: 101, Sgids: []int{33}, Home: "/var/lib/nginx"}},
+		{"nginx:www", []string{"audio", "1000"}, ExecUser{Uid: 101, Gid: 33, Sgids: []int{29, 1000}, Home: "/var/lib/nginx"}},
+		{"1000:1000", nil, ExecUser{Uid: 1000, Gid: 1000, Home: "/"}},
+		{"101", nil, ExecUser{Uid: 101, Gid: 101, Sgids: []int{33}, Home: "/var/lib/nginx"}},
+	}
+	for _, c := range cases {
+		user, err := GetExecUser(c.spec, c.groupAdd, rootfs)
+		if err != nil {
+			t.Errorf("get exec user %s error %v", c.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(*user, c.want) {
+			t.Errorf("get exec user %s: expect %+v, got %+v", c.spec, c.want, *user)
+		}
+	}
+
+	if _, err := GetExecUser("nobody", nil, rootfs); err == nil {
+		t.Errorf("unknown user should fail")
+	}
+	if _, err := GetExecUser("nginx:nogroup", nil, rootfs); err == nil {
+		t.Errorf("unknown group should fail")
+	}
+}
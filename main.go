@@ -14,9 +14,20 @@ func main() {
 	app := cli.NewApp()
 	app.Name = "minidocker"
 	app.Usage = usage
+	app.Flags = []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "default-ulimit",
+			Usage: "default ulimits for containers (name=soft[:hard])",
+		},
+		cli.StringFlag{
+			Name:  "default-cgroup-parent",
+			Usage: "default parent cgroup for containers, e.g. minidocker.slice",
+		},
+	}
 
 	app.Commands = []cli.Command{
 		cmd.InitCommand,
+		cmd.MonitorCommand,
 		cmd.RunCommand,
 		cmd.CommitCommand,
 		cmd.ListCommand,
@@ -24,6 +35,12 @@ func main() {
 		cmd.ExecCommand,
 		cmd.StopCommand,
 		cmd.RemoveCommand,
+		cmd.InspectCommand,
+		cmd.UpdateCommand,
+		cmd.StatsCommand,
+		cmd.TopCommand,
+		cmd.PortCommand,
+		cmd.EventsCommand,
 		cmd.NetworkCommand,
 	}
 	app.Before = func(_ *cli.Context) error {
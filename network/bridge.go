@@ -2,13 +2,15 @@ package network
 
 import (
 	"fmt"
+	"hash/fnv"
+	"io/ioutil"
 	"net"
-	"os/exec"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 type BridgeNetworkDriver struct {
@@ -86,24 +88,39 @@ func setInterfaceIP(name string, rawIP string) error {
 		Flags:       0,
 		Scope:       0,
 	}
+	// ipv6地址跳过重复地址检测, 否则地址在检测完成前处于tentative状态无法使用
+	if ipNet.IP.To4() == nil {
+		addr.Flags = unix.IFA_F_NODAD
+	}
   // AddrAdd相当于 ip addr add xxx
   // 如果配置了地址所在的网段的信息,如192.168.0.0/24
   // 还会配置路由表192.168.0.0/24转发到这个testbridge的网络接口上
 	return netlink.AddrAdd(iface, addr)
 }
 
-// 设置iptables对应的bridge的MASQUERADE规则
-func setupIPTables(bridgeName string, subnet *net.IPNet) error {
-  // 创建iptables命令
-  // iptables -t nat -A POSTROUTING -s <bridgeName> ! -o <bridgeName> -j MASQUERADE
-	iptablesCmd := fmt.Sprintf("-t nat -A POSTROUTING -s %s ! -o %s -j MASQUERADE", subnet.String(), bridgeName)
-	cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
-  // 执行iptables命令配置SNAT规则
-	output, err := cmd.Output()
-	if err != nil {
-		logrus.Errorf("iptables output, %v", output)
+// 打开网络接口的ipv6, 需要在对应的net namespace中调用
+func enableIPv6(interfaceName string) error {
+	return ioutil.WriteFile(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/disable_ipv6", interfaceName), []byte("0"), 0644)
+}
+
+// bridge对应网段的MASQUERADE规则, ipv6还需要FORWARD规则
+func bridgeIptablesRules(bridgeName string, subnet *net.IPNet) []IptablesRule {
+  // iptables -t nat -A POSTROUTING -s <subnet> ! -o <bridgeName> -j MASQUERADE
+	rules := []IptablesRule{
+		newIptablesRule(subnet.IP, "nat", "POSTROUTING", false,
+			fmt.Sprintf("-s %s ! -o %s -j MASQUERADE", subnet.String(), bridgeName)),
 	}
-	return err
+	if subnet.IP.To4() != nil {
+		// 宿主机通过127.0.0.1访问发布的端口时, 源地址需要转换为bridge的地址
+		rules = append(rules, newIptablesRule(subnet.IP, "nat", "POSTROUTING", false,
+			fmt.Sprintf("-o %s -m addrtype --src-type LOCAL -j MASQUERADE", bridgeName)))
+	} else {
+		// ip6tables的FORWARD链默认策略可能为DROP, 放行bridge进出的流量
+		rules = append(rules,
+			newIptablesRule(subnet.IP, "filter", "FORWARD", true, fmt.Sprintf("-i %s -j ACCEPT", bridgeName)),
+			newIptablesRule(subnet.IP, "filter", "FORWARD", true, fmt.Sprintf("-o %s -j ACCEPT", bridgeName)))
+	}
+	return rules
 }
 
 // 初始化Bridge
@@ -116,11 +133,18 @@ func (d *BridgeNetworkDriver) initBridge(n *Network) error {
 	}
 
 	// set bridge IP and router
-	gatewayIP := *n.IpRange
-	gatewayIP.IP = n.IpRange.IP
+	for _, ipRange := range n.ipRanges() {
+		if ipRange.IP.To4() == nil {
+			if err := enableIPv6(bridgeName); err != nil {
+				return fmt.Errorf("error enable ipv6 on bridge: %s, error: %v", bridgeName, err)
+			}
+		}
+		gatewayIP := *ipRange
+		gatewayIP.IP = ipRange.IP
 
-	if err := setInterfaceIP(bridgeName, gatewayIP.String()); err != nil {
-		return fmt.Errorf("error assigning address: %s on bridge: %s with an eror of: %v", gatewayIP, bridgeName, err)
+		if err := setInterfaceIP(bridgeName, gatewayIP.String()); err != nil {
+			return fmt.Errorf("error assigning address: %s on bridge: %s with an eror of: %v", gatewayIP, bridgeName, err)
+		}
 	}
 
   // start bridge dev
@@ -129,25 +153,54 @@ func (d *BridgeNetworkDriver) initBridge(n *Network) error {
 	}
 
 	// setup tables
-	if err := setupIPTables(bridgeName, n.IpRange); err != nil {
-		return fmt.Errorf("error setting iptables for %s: %v", bridgeName, err)
+	for _, ipRange := range n.ipRanges() {
+		if ipRange.IP.To4() == nil {
+			// 宿主机需要开启ipv6转发
+			if err := ioutil.WriteFile("/proc/sys/net/ipv6/conf/all/forwarding", []byte("1"), 0644); err != nil {
+				return fmt.Errorf("error enable ipv6 forwarding: %v", err)
+			}
+		} else {
+			// 允许OUTPUT链将127.0.0.1的访问DNAT到bridge上的容器
+			if err := ioutil.WriteFile(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/route_localnet", bridgeName), []byte("1"), 0644); err != nil {
+				return fmt.Errorf("error enable route_localnet on bridge %s: %v", bridgeName, err)
+			}
+		}
+		// 记录添加的规则, 删除网络时删除完全相同的规则
+		rules := bridgeIptablesRules(bridgeName, ipRange)
+		if err := addIptablesRules(rules); err != nil {
+			return fmt.Errorf("error setting iptables for %s: %v", bridgeName, err)
+		}
+		n.IptablesRules = append(n.IptablesRules, rules...)
 	}
 	return nil
 }
 
-func (d *BridgeNetworkDriver) Create(subnet string, name string) (*Network, error) {
-  // 获取网段字符串中的网关IP地址和网络的IP段
-	ip, ipRange, _ := net.ParseCIDR(subnet)
-	ipRange.IP = ip
+func (d *BridgeNetworkDriver) Create(subnets []string, name string) (*Network, error) {
   // 初始化网络对象
 	n := &Network{
 		Name:    name,
-		IpRange: ipRange,
 		Driver:  d.Name(),
 	}
+  // 获取网段字符串中的网关IP地址和网络的IP段
+	for _, subnet := range subnets {
+		ip, ipRange, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+		ipRange.IP = ip
+		if ip.To4() != nil {
+			n.IpRange = ipRange
+		} else {
+			n.IpRange6 = ipRange
+		}
+	}
 	err := d.initBridge(n)
 	if err != nil {
 		logrus.Errorf("error init bridge: %v", err)
+		// 清理已经创建的bridge和iptables规则
+		if err := d.Delete(*n); err != nil {
+			logrus.Errorf("error clean up bridge: %v", err)
+		}
 	}
   // 返回配置好的网络
 	return n, err
@@ -156,9 +209,20 @@ func (d *BridgeNetworkDriver) Create(subnet string, name string) (*Network, erro
 func (d *BridgeNetworkDriver) Delete(network Network) error {
   // 网络名即linux bridge设备名
 	bridgeName := network.Name
+	rules := network.IptablesRules
+	// 旧版本没有记录规则, 按创建时的方式重新生成
+	if rules == nil && network.IpRange != nil {
+		rules = bridgeIptablesRules(bridgeName, network.IpRange)
+	}
+	if err := deleteIptablesRules(rules); err != nil {
+		logrus.Errorf("error delete iptables for %s: %v", bridgeName, err)
+	}
   // 通过netlink的LinkByName获取对应的设备
 	br, err := netlink.LinkByName(bridgeName)
 	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
 		return err
 	}
   // 删除linux bridge设备
@@ -166,7 +230,23 @@ func (d *BridgeNetworkDriver) Delete(network Network) error {
 }
 
 func (d *BridgeNetworkDriver) Disconnect(network Network, endpoint *Endpoint) error {
-	return nil
+	// 删除veth宿主机一端, 容器内的一端随之删除
+	veth, err := netlink.LinkByName(endpoint.Device.Name)
+	if err != nil {
+		// 容器退出后net namespace销毁, veth已经被内核删除
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	return netlink.LinkDel(veth)
+}
+
+// veth设备名的后缀, 同一个容器连接多个网络时endpoint id的前缀相同, 取id的哈希
+func vethSuffix(endpointId string) string {
+	h := fnv.New32a()
+	h.Write([]byte(endpointId))
+	return fmt.Sprintf("%08x", h.Sum32())
 }
 
 func (d *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) error {
@@ -180,16 +260,18 @@ func (d *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) erro
 
   // 创建veth属性
 	la := netlink.NewLinkAttrs()
-  // 由于Linux接口名限制，名字取endpoint id的前5位
-	la.Name = endpoint.ID[:5]
+  // 由于Linux接口名限制，名字取endpoint id哈希的8位
+	suffix := vethSuffix(endpoint.ID)
+	la.Name = "veth" + suffix
   // 通过设置veth接口的master属性,设置这个veth的一端挂载到网络对应的linux bridge上
 	la.MasterIndex = br.Attrs().Index
 
   // 创建veth对象,通过PeerName配置veth另一端的接口名
-  // 配置veth另一端的名字cif-{endpoint ID的前5位}
+  // 配置veth另一端的名字cif-{endpoint ID的哈希}, 移入容器后重命名为ethN
 	endpoint.Device = netlink.Veth{
-		LinkAttrs: la,
-		PeerName:  "cif-" + endpoint.ID[:5],
+		LinkAttrs:        la,
+		PeerName:         "cif-" + suffix,
+		PeerHardwareAddr: endpoint.MacAddress,
 	}
 
   // 调用netlink的linkadd方法创建这个veth接口
@@ -204,5 +286,18 @@ func (d *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) erro
 	if err = netlink.LinkSetUp(&endpoint.Device); err != nil {
 		return fmt.Errorf("error Add Endpoint Device: %v", err)
 	}
+	// 开启hairpin, 容器通过发布的端口访问自身时报文需要从同一个bridge端口返回
+	if err = netlink.LinkSetHairpin(&endpoint.Device, true); err != nil {
+		return fmt.Errorf("error set hairpin mode: %v", err)
+	}
+
+	// 没有指定mac地址时记录内核生成的地址
+	if endpoint.MacAddress == nil {
+		peer, err := netlink.LinkByName(endpoint.Device.PeerName)
+		if err != nil {
+			return fmt.Errorf("error get Endpoint Device peer: %v", err)
+		}
+		endpoint.MacAddress = peer.Attrs().HardwareAddr
+	}
 	return nil
 }
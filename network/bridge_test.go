@@ -7,7 +7,7 @@ import (
 
 func TestBridgeInit(t *testing.T) {
 	d := BridgeNetworkDriver{}
-	nw, err := d.Create("192.168.0.1/24", "testbridge")
+	nw, err := d.Create([]string{"192.168.0.1/24"}, "testbridge")
 	t.Logf("create err: %v", err)
 	err = d.Delete(*nw)
 	t.Logf("delete err: %v", err)
@@ -15,7 +15,7 @@ func TestBridgeInit(t *testing.T) {
 
 func TestBridgeConnect(t *testing.T) {
 	d := BridgeNetworkDriver{}
-	nw, err := d.Create("192.168.0.1/24", "testbridge")
+	nw, err := d.Create([]string{"192.168.0.1/24"}, "testbridge")
 	t.Logf("create err: %v", err)
 
 	ep := Endpoint{
@@ -38,7 +38,7 @@ func TestNetworkConnect(t *testing.T) {
 		Pid: "15438",
 	}
 	d := BridgeNetworkDriver{}
-	n, err := d.Create("192.168.0.1/24", "testbridge")
+	n, err := d.Create([]string{"192.168.0.1/24"}, "testbridge")
 	t.Logf("create error: %v", err)
 
 	if err := Init(); err != nil {
@@ -3,6 +3,7 @@ package network
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"minidocker/container"
 	"net"
 	"os"
@@ -14,12 +15,19 @@ import (
 
 // 网络端点
 type Endpoint struct {
-	ID          string           `json:"id"`
-	Device      netlink.Veth     `json:"dev"`
+	ID            string       `json:"id"`
+	ContainerId   string       `json:"containerId"`
+	ContainerName string       `json:"containerName"`
+	Device        netlink.Veth `json:"dev"`
+	// 容器内的接口名, eth0, eth1...
+	Interface   string           `json:"ifname"`
 	IPAddress   net.IP           `json:"ip"`
+	IPv6Address net.IP           `json:"ip6"`
 	MacAddress  net.HardwareAddr `json:"mac"`
 	Network     *Network
-	PortMapping []string
+	Ports       []container.PortBinding `json:"ports"`
+	// 端口映射添加的iptables规则, 断开网络时删除
+	IptablesRules []IptablesRule `json:"iptablesRules"`
 }
 
 var (
@@ -84,22 +92,14 @@ func (ep *Endpoint) remove(dumpPath string) error {
 }
 
 func (ep *Endpoint) load(dumpPath string) error {
-	// 打开配置文件
-	nwConfigFile, err := os.Open(dumpPath)
-	if err != nil {
-		return err
-	}
-	defer nwConfigFile.Close()
-
-	// 从配置文件中读取网络的配置json字符串
-	epJson := make([]byte, 2000)
-	n, err := nwConfigFile.Read(epJson)
+	// 读取配置文件中的json字符串, 端点记录了iptables规则, 文件大小不固定
+	epJson, err := ioutil.ReadFile(dumpPath)
 	if err != nil {
 		return err
 	}
 
 	// json字符串反序列换出网络配置
-	err = json.Unmarshal(epJson[:n], ep)
+	err = json.Unmarshal(epJson, ep)
 	if err != nil {
 		logrus.Errorf("Error load nw info %v", err)
 		return err
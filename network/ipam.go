@@ -1,23 +1,35 @@
 package network
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
 	"net"
 	"os"
 	"path"
-	"strings"
-
-	"github.com/sirupsen/logrus"
+	"syscall"
 )
 
 const ipamDefaultAllocatorPath = "/var/run/minidocker/network/ipam/subnet.json"
 
+// subnet.json的格式版本, 旧版本每个地址用一个'0'/'1'字符表示
+const ipamStateVersion = 2
+
 // 存放IP分配信息
 type IPAM struct {
 	// 分配文件存放位置
 	SubnetAllocatorPath string
-	// 网段和位图算法的数组map,key是网段,value是分配的位图数组
-	Subnets *map[string]string
+	// 网段和位图的map, key是网段, value是位图
+	// 位图的第n位表示网段中偏移为n的地址是否已经分配, 只保存到最后一个已分配的地址
+	Subnets map[string][]byte
+}
+
+// subnet.json中保存的内容
+type ipamState struct {
+	Version int               `json:"version"`
+	Subnets map[string][]byte `json:"subnets"`
 }
 
 // 初始化IPAM对象
@@ -25,155 +37,239 @@ var ipAllocator = &IPAM{
 	SubnetAllocatorPath: ipamDefaultAllocatorPath,
 }
 
-// 加载网络地址分配信息
+// 加载网络地址分配信息, 文件不存在时为空
 func (ipam *IPAM) load() error {
-	// 检查文件是否存在,如果不存在,则不需要加载
-	if _, err := os.Stat(ipam.SubnetAllocatorPath); err != nil {
+	ipam.Subnets = map[string][]byte{}
+	content, err := ioutil.ReadFile(ipam.SubnetAllocatorPath)
+	if err != nil {
 		if os.IsNotExist(err) {
-			return err
-		} else {
 			return nil
 		}
-	}
-	// 打开文件并读取
-	subnetConfigFile, err := os.Open(ipam.SubnetAllocatorPath)
-	if err != nil {
 		return err
 	}
-	defer subnetConfigFile.Close()
-	subnetJson := make([]byte, 2000)
-	n, err := subnetConfigFile.Read(subnetJson)
-	if err != nil {
+	if len(content) == 0 {
 		return nil
 	}
-	// 将文件中的内容反序列化为IP分配信息
-	err = json.Unmarshal(subnetJson[:n], ipam.Subnets)
-	if err != nil {
-		logrus.Errorf("error dump allocation info %v", err)
-		return err
+	var state ipamState
+	if err := json.Unmarshal(content, &state); err == nil && state.Version == ipamStateVersion {
+		if state.Subnets != nil {
+			ipam.Subnets = state.Subnets
+		}
+		return nil
+	}
+	// 兼容旧格式, 旧格式中第c个字符对应偏移为c+1的地址
+	legacy := map[string]string{}
+	if err := json.Unmarshal(content, &legacy); err != nil {
+		return fmt.Errorf("error load allocation info %v", err)
+	}
+	for subnet, alloc := range legacy {
+		var bitmap []byte
+		for c := range alloc {
+			if alloc[c] == '1' {
+				bitmap = setBit(bitmap, uint64(c)+1)
+			}
+		}
+		ipam.Subnets[subnet] = bitmap
 	}
 	return nil
 }
 
-// 存储网段地址分配信息
+// 存储网段地址分配信息, 先写临时文件再rename, 保证文件完整
 func (ipam *IPAM) dump() error {
-	// 检查文件是否存在,如果不存在则创建
 	ipamConfigFileDir, _ := path.Split(ipam.SubnetAllocatorPath)
-	if _, err := os.Stat(ipamConfigFileDir); err != nil {
-		if os.IsNotExist(err) {
-			if err := os.MkdirAll(ipamConfigFileDir, 0644); err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
+	if err := os.MkdirAll(ipamConfigFileDir, 0755); err != nil {
+		return err
 	}
-	// 打开文件,O_TRUNC如果存在则清空,O_CREATE如果不存在则创建
-	subnetConfigFile, err := os.OpenFile(ipam.SubnetAllocatorPath, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0644)
+	content, err := json.Marshal(&ipamState{
+		Version: ipamStateVersion,
+		Subnets: ipam.Subnets,
+	})
 	if err != nil {
 		return err
 	}
-	defer subnetConfigFile.Close()
+	tmpFile := ipam.SubnetAllocatorPath + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, ipam.SubnetAllocatorPath)
+}
 
-	// 将IPAM对象序列化为json
-	ipamConfigJson, err := json.Marshal(ipam.Subnets)
+// 持有文件锁时加载, 修改并保存分配信息, 避免多个minidocker进程同时分配到同一个IP
+func (ipam *IPAM) update(fn func() error) error {
+	ipamConfigFileDir, _ := path.Split(ipam.SubnetAllocatorPath)
+	if err := os.MkdirAll(ipamConfigFileDir, 0755); err != nil {
+		return err
+	}
+	lockFile, err := os.OpenFile(ipam.SubnetAllocatorPath+".lock", os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
-		return nil
+		return err
+	}
+	defer lockFile.Close()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock ipam error %v", err)
 	}
+	defer syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
 
-	// 将序列化后的字符写入文件
-	_, err = subnetConfigFile.Write(ipamConfigJson)
-	if err != nil {
+	if err := ipam.load(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
 		return err
 	}
+	return ipam.dump()
+}
 
-	return nil
+func testBit(bitmap []byte, i uint64) bool {
+	if i/8 >= uint64(len(bitmap)) {
+		return false
+	}
+	return bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+func setBit(bitmap []byte, i uint64) []byte {
+	for i/8 >= uint64(len(bitmap)) {
+		bitmap = append(bitmap, 0)
+	}
+	bitmap[i/8] |= 1 << (i % 8)
+	return bitmap
+}
+
+// 清除之后去掉末尾的0, 让位图只保存到最后一个已分配的地址
+func clearBit(bitmap []byte, i uint64) []byte {
+	if i/8 < uint64(len(bitmap)) {
+		bitmap[i/8] &^= 1 << (i % 8)
+	}
+	for len(bitmap) > 0 && bitmap[len(bitmap)-1] == 0 {
+		bitmap = bitmap[:len(bitmap)-1]
+	}
+	return bitmap
+}
+
+// 网段中可以分配的地址偏移范围, 排除网络地址和ipv4的广播地址
+func hostRange(subnet *net.IPNet) (uint64, uint64, error) {
+	ones, bits := subnet.Mask.Size()
+	if subnet.IP.To4() == nil {
+		// ipv6的位图偏移只取低64位, 且没有广播地址
+		if ones < 64 || ones > 126 {
+			return 0, 0, fmt.Errorf("unsupported subnet %s, ipv6 prefix length must be between 64 and 126", subnet)
+		}
+		if ones == 64 {
+			return 1, math.MaxUint64, nil
+		}
+		return 1, 1<<uint(bits-ones) - 1, nil
+	}
+	if ones < 8 || ones > 30 {
+		return 0, 0, fmt.Errorf("unsupported subnet %s, prefix length must be between 8 and 30", subnet)
+	}
+	return 1, 1<<uint(bits-ones) - 2, nil
+}
+
+// 取IP的低64位, ipv4为全部32位
+func ipLow(ip net.IP) uint64 {
+	if ip4 := ip.To4(); ip4 != nil {
+		return uint64(binary.BigEndian.Uint32(ip4))
+	}
+	return binary.BigEndian.Uint64(ip.To16()[8:])
+}
+
+// 地址在网段中的偏移
+func ipToOffset(subnet *net.IPNet, ip net.IP) (uint64, error) {
+	if !subnet.Contains(ip) {
+		return 0, fmt.Errorf("ip %s is not in subnet %s", ip, subnet)
+	}
+	return ipLow(ip) - ipLow(subnet.IP), nil
+}
+
+// 网络地址加上偏移得到IP, 进位由整数加法处理
+func offsetToIP(subnet *net.IPNet, offset uint64) net.IP {
+	if ip4 := subnet.IP.To4(); ip4 != nil {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(ipLow(ip4)+offset))
+		return ip
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, subnet.IP.To16())
+	binary.BigEndian.PutUint64(ip[8:], ipLow(subnet.IP)+offset)
+	return ip
 }
 
 // 在网段中分配一个可用的IP地址
 func (ipam *IPAM) Allocate(subnet *net.IPNet) (ip net.IP, err error) {
-	// 存放网段中地址分配信息
-	ipam.Subnets = &map[string]string{}
-	// 从文件中加载已经分配的网段信息
-	err = ipam.load()
+	// 转换为网络地址
+	_, subnet, err = net.ParseCIDR(subnet.String())
+	if err != nil {
+		return nil, err
+	}
+	first, last, err := hostRange(subnet)
 	if err != nil {
-		logrus.Infof("Allocate: error load allocation info, %v", err)
-	}
-
-	// 转换IPNet对象
-	_, subnet, _ = net.ParseCIDR(subnet.String())
-
-	// 获取子网掩码在长度和网段前面的固定位的长度
-	// 如"127.0.0.1/8"网段的子网掩码是"255.0.0.0"
-	// 那么subnet.Mask.Size*()的返回值就是前面255对应的位数和总位数,即8和24
-	one, size := subnet.Mask.Size()
-
-	// 如果之前没有分配过这个网段,则初始化网段分配配置
-	if _, exist := (*ipam.Subnets)[subnet.String()]; !exist {
-		(*ipam.Subnets)[subnet.String()] = strings.Repeat("0", 1<<uint8(size-one))
-	}
-
-	// 遍历网段的位图数组
-	for c := range (*ipam.Subnets)[subnet.String()] {
-		// 找到数组的0项和数组序号即可分配IP
-		if (*ipam.Subnets)[subnet.String()][c] == '0' {
-			// 设置这个'0'项的值位'1',即分配这个IP
-			ipalloc := []byte((*ipam.Subnets)[subnet.String()])
-			// go的字符串创建后就不能修改,所以通过转换成byte数组,修改后再转化位字符串赋值
-			ipalloc[c] = '1'
-			(*ipam.Subnets)[subnet.String()] = string(ipalloc)
-			// 初始IP
-			ip = subnet.IP
-			// 通过网段的IP与上面的偏移相加计算出分配的IP地址，由于IP地址是uint的一个数组
-			// 需要通过数组中的每一项相加所需的值
-			// 如网段"172.16.0.0/12"，数组序号是65555,那么在"172.16.0.0"上依次加
-			// [uint8(65555>>24),uint8(65555>>16),uint8(65555>>8), uint8(65555>>0)]
-			// 即[0,1,0,19],那么获得的IP为172.17.0.19
-			for t := uint(4); t > 0; t -= 1 {
-				[]byte(ip)[4-t] += uint8(c >> ((t - 1) * 8))
+		return nil, err
+	}
+	err = ipam.update(func() error {
+		bitmap := ipam.Subnets[subnet.String()]
+		for i := first; i <= last; i++ {
+			// 跳过已经全部分配的字节
+			if i%8 == 0 && i/8 < uint64(len(bitmap)) && bitmap[i/8] == 0xff {
+				i += 7
+				continue
+			}
+			if !testBit(bitmap, i) {
+				ipam.Subnets[subnet.String()] = setBit(bitmap, i)
+				ip = offsetToIP(subnet, i)
+				return nil
 			}
-			// IP从1开始分配,所以此处+1
-			ip[3] += 1
-			break
 		}
-	}
-	// 将结果保存到文件中
-	if err := ipam.dump(); err != nil {
-		logrus.Errorf("ipam dump error %v", err)
+		return fmt.Errorf("no available ip in subnet %s", subnet)
+	})
+	if err != nil {
+		return nil, err
 	}
 	return ip, nil
 }
 
-// 地址释放
-func (ipam *IPAM) Release(subnet *net.IPNet, ipaddr *net.IP) error {
-	ipam.Subnets = &map[string]string{}
-	_, subnet, _ = net.ParseCIDR(subnet.String())
-
-	// 从文件中加载网段的分配信息
-	err := ipam.load()
+// 分配指定的IP地址, 地址已被占用或不在网段的可分配范围内时返回错误
+func (ipam *IPAM) Reserve(subnet *net.IPNet, ip net.IP) error {
+	_, subnet, err := net.ParseCIDR(subnet.String())
 	if err != nil {
-		logrus.Errorf("error dump allocation info, %v", err)
+		return err
 	}
-
-	// 计算IP地址在网段位图中的索引位置
-	c := 0
-	// 将IP地址转化位4字节的表示方式
-	releaseIP := ipaddr.To4()
-	// 由于IP是从1开始分配,所以此处-1
-	releaseIP[3] -= 1
-	for t := uint(4); t > 0; t -= 1 {
-		// 与IP分配相反
-		c += int(releaseIP[t-1]-subnet.IP[t-1]) << ((4 - t) * 8)
+	first, last, err := hostRange(subnet)
+	if err != nil {
+		return err
 	}
+	offset, err := ipToOffset(subnet, ip)
+	if err != nil {
+		return err
+	}
+	if offset < first || offset > last {
+		return fmt.Errorf("ip %s is not assignable in subnet %s", ip, subnet)
+	}
+	return ipam.update(func() error {
+		bitmap := ipam.Subnets[subnet.String()]
+		if testBit(bitmap, offset) {
+			return fmt.Errorf("ip %s is already in use", ip)
+		}
+		ipam.Subnets[subnet.String()] = setBit(bitmap, offset)
+		return nil
+	})
+}
 
-	// 将分配的位图数组中索引位置的值置为0
-	ipalloc := []byte((*ipam.Subnets)[subnet.String()])
-	ipalloc[c] = '0'
-	(*ipam.Subnets)[subnet.String()] = string(ipalloc)
-
-	// 保存
-	if err := ipam.dump(); err != nil {
+// 地址释放
+func (ipam *IPAM) Release(subnet *net.IPNet, ipaddr *net.IP) error {
+	_, subnet, err := net.ParseCIDR(subnet.String())
+	if err != nil {
 		return err
 	}
-	return nil
+	offset, err := ipToOffset(subnet, *ipaddr)
+	if err != nil {
+		return err
+	}
+	return ipam.update(func() error {
+		bitmap := clearBit(ipam.Subnets[subnet.String()], offset)
+		if len(bitmap) == 0 {
+			delete(ipam.Subnets, subnet.String())
+		} else {
+			ipam.Subnets[subnet.String()] = bitmap
+		}
+		return nil
+	})
 }
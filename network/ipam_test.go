@@ -1,7 +1,12 @@
 package network
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -33,3 +38,171 @@ func TestRelease(t *testing.T) {
 		t.Logf("error %v\n", err)
 	}
 }
+
+func newTestIPAM(t *testing.T) (*IPAM, func()) {
+	dir, err := ioutil.TempDir("", "ipam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &IPAM{SubnetAllocatorPath: path.Join(dir, "subnet.json")}, func() { os.RemoveAll(dir) }
+}
+
+func TestAllocateSmallSubnet(t *testing.T) {
+	ipam, cleanup := newTestIPAM(t)
+	defer cleanup()
+	_, ipnet, _ := net.ParseCIDR("10.0.0.4/30")
+	for _, want := range []string{"10.0.0.5", "10.0.0.6"} {
+		ip, err := ipam.Allocate(ipnet)
+		if err != nil || ip.String() != want {
+			t.Fatalf("expect %s, got %v %v", want, ip, err)
+		}
+	}
+	// 网络地址和广播地址不能分配
+	if ip, err := ipam.Allocate(ipnet); err == nil {
+		t.Fatalf("expect subnet full, got %v", ip)
+	}
+	ip := net.ParseIP("10.0.0.5")
+	if err := ipam.Release(ipnet, &ip); err != nil {
+		t.Fatal(err)
+	}
+	if ip, err := ipam.Allocate(ipnet); err != nil || ip.String() != "10.0.0.5" {
+		t.Fatalf("expect 10.0.0.5 after release, got %v %v", ip, err)
+	}
+}
+
+func TestAllocateCarry(t *testing.T) {
+	ipam, cleanup := newTestIPAM(t)
+	defer cleanup()
+	_, ipnet, _ := net.ParseCIDR("172.18.0.0/16")
+	var ip net.IP
+	var err error
+	for i := 0; i < 256; i++ {
+		if ip, err = ipam.Allocate(ipnet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ip.String() != "172.18.1.0" {
+		t.Fatalf("expect 172.18.1.0, got %v", ip)
+	}
+}
+
+func TestAllocatePrefixLength(t *testing.T) {
+	ipam, cleanup := newTestIPAM(t)
+	defer cleanup()
+	for _, subnet := range []string{"10.0.0.0/7", "10.0.0.0/31", "10.0.0.0/32"} {
+		_, ipnet, _ := net.ParseCIDR(subnet)
+		if _, err := ipam.Allocate(ipnet); err == nil {
+			t.Errorf("subnet %s: expect error", subnet)
+		}
+	}
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+	if ip, err := ipam.Allocate(ipnet); err != nil || ip.String() != "10.0.0.1" {
+		t.Errorf("expect 10.0.0.1, got %v %v", ip, err)
+	}
+}
+
+func TestLoadLegacyFormat(t *testing.T) {
+	ipam, cleanup := newTestIPAM(t)
+	defer cleanup()
+	legacy := `{"192.168.0.0/24":"110` + strings.Repeat("0", 253) + `"}`
+	if err := ioutil.WriteFile(ipam.SubnetAllocatorPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, ipnet, _ := net.ParseCIDR("192.168.0.0/24")
+	if ip, err := ipam.Allocate(ipnet); err != nil || ip.String() != "192.168.0.3" {
+		t.Fatalf("expect 192.168.0.3, got %v %v", ip, err)
+	}
+}
+
+func TestConcurrentAllocate(t *testing.T) {
+	ipam, cleanup := newTestIPAM(t)
+	defer cleanup()
+	_, ipnet, _ := net.ParseCIDR("10.10.0.0/24")
+	var wg sync.WaitGroup
+	ips := make(chan string, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 每个goroutine使用独立的IPAM实例, 模拟多个minidocker进程
+			allocator := &IPAM{SubnetAllocatorPath: ipam.SubnetAllocatorPath}
+			ip, err := allocator.Allocate(ipnet)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ips <- ip.String()
+		}()
+	}
+	wg.Wait()
+	close(ips)
+	seen := map[string]bool{}
+	for ip := range ips {
+		if seen[ip] {
+			t.Errorf("ip %s allocated twice", ip)
+		}
+		seen[ip] = true
+	}
+}
+
+func TestAllocateIPv6(t *testing.T) {
+	ipam, cleanup := newTestIPAM(t)
+	defer cleanup()
+	_, ipnet, _ := net.ParseCIDR("fd00::/64")
+	for _, expect := range []string{"fd00::1", "fd00::2"} {
+		if ip, err := ipam.Allocate(ipnet); err != nil || ip.String() != expect {
+			t.Fatalf("expect %s, got %v %v", expect, ip, err)
+		}
+	}
+	ip := net.ParseIP("fd00::1")
+	if err := ipam.Release(ipnet, &ip); err != nil {
+		t.Fatal(err)
+	}
+	if ip, err := ipam.Allocate(ipnet); err != nil || ip.String() != "fd00::1" {
+		t.Errorf("expect fd00::1, got %v %v", ip, err)
+	}
+
+	// ipv6没有广播地址, /126中的最后一个地址也可以分配
+	_, small, _ := net.ParseCIDR("fd00:1::/126")
+	for _, expect := range []string{"fd00:1::1", "fd00:1::2", "fd00:1::3"} {
+		if ip, err := ipam.Allocate(small); err != nil || ip.String() != expect {
+			t.Fatalf("expect %s, got %v %v", expect, ip, err)
+		}
+	}
+	if _, err := ipam.Allocate(small); err == nil {
+		t.Errorf("expect subnet %s to be exhausted", small)
+	}
+
+	for _, subnet := range []string{"fd00::/48", "fd00::/127"} {
+		_, ipnet, _ := net.ParseCIDR(subnet)
+		if _, err := ipam.Allocate(ipnet); err == nil {
+			t.Errorf("subnet %s: expect error", subnet)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ipam, cleanup := newTestIPAM(t)
+	defer cleanup()
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/24")
+	if err := ipam.Reserve(ipnet, net.ParseIP("10.0.0.50")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve(ipnet, net.ParseIP("10.0.0.50")); err == nil {
+		t.Errorf("expect error reserving ip in use")
+	}
+	for _, ip := range []string{"10.0.1.1", "10.0.0.0", "10.0.0.255"} {
+		if err := ipam.Reserve(ipnet, net.ParseIP(ip)); err == nil {
+			t.Errorf("ip %s: expect error", ip)
+		}
+	}
+	// 动态分配跳过预留的地址
+	for i := 1; i < 50; i++ {
+		if _, err := ipam.Allocate(ipnet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ip, err := ipam.Allocate(ipnet); err != nil || ip.String() != "10.0.0.51" {
+		t.Errorf("expect 10.0.0.51, got %v %v", ip, err)
+	}
+}
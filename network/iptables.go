@@ -0,0 +1,86 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 创建的iptables规则, 保存下来以便删除时使用完全相同的规则
+type IptablesRule struct {
+	Binary string   `json:"binary"`
+	Table  string   `json:"table"`
+	Chain  string   `json:"chain"`
+	Insert bool     `json:"insert"`
+	Spec   []string `json:"spec"`
+}
+
+func newIptablesRule(ip net.IP, table, chain string, insert bool, spec string) IptablesRule {
+	return IptablesRule{
+		Binary: iptablesBinary(ip),
+		Table:  table,
+		Chain:  chain,
+		Insert: insert,
+		Spec:   strings.Split(spec, " "),
+	}
+}
+
+func (r IptablesRule) String() string {
+	return fmt.Sprintf("%s -t %s %s %s", r.Binary, r.Table, r.Chain, strings.Join(r.Spec, " "))
+}
+
+func (r IptablesRule) run(action string) error {
+	args := append([]string{"-t", r.Table, action, r.Chain}, r.Spec...)
+	output, err := exec.Command(r.Binary, args...).CombinedOutput()
+	if err != nil {
+		logrus.Errorf("iptables output, %s", output)
+		return fmt.Errorf("%s %s: %v", action, r, err)
+	}
+	return nil
+}
+
+// 添加规则, FORWARD等规则需要插入到链的开头
+func (r IptablesRule) add() error {
+	if r.Insert {
+		return r.run("-I")
+	}
+	return r.run("-A")
+}
+
+func (r IptablesRule) del() error {
+	return r.run("-D")
+}
+
+// 依次添加规则, 失败时删除已经添加的规则
+func addIptablesRules(rules []IptablesRule) error {
+	for i, rule := range rules {
+		if err := rule.add(); err != nil {
+			deleteIptablesRules(rules[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// 按添加的相反顺序删除规则, 删除失败时继续删除其余的规则
+func deleteIptablesRules(rules []IptablesRule) error {
+	var lastErr error
+	for i := len(rules) - 1; i >= 0; i-- {
+		if err := rules[i].del(); err != nil {
+			logrus.Errorf("delete iptables rule error %v", err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// 地址对应的iptables命令, ipv6使用ip6tables
+func iptablesBinary(ip net.IP) string {
+	if ip.To4() == nil {
+		return "ip6tables"
+	}
+	return "iptables"
+}
@@ -4,13 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"io/ioutil"
 	"minidocker/container"
 	"net"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 
@@ -30,8 +32,8 @@ var (
 type NetworkDriver interface {
 	// 驱动名
 	Name() string
-	// 创建网络
-	Create(subnet string, name string) (*Network, error)
+	// 创建网络, subnets为带网关地址的网段, 每个地址族最多一个
+	Create(subnets []string, name string) (*Network, error)
 	// 删除网络
 	Delete(network Network) error
 	// 连接容器网络端点到网络
@@ -41,9 +43,23 @@ type NetworkDriver interface {
 }
 
 type Network struct {
-	Name    string     // 网络名
-	IpRange *net.IPNet // 地址段
-	Driver  string     // 网络驱动名
+	Name     string     // 网络名
+	IpRange  *net.IPNet // 地址段
+	IpRange6 *net.IPNet // ipv6地址段, 未开启ipv6时为nil
+	Driver   string     // 网络驱动名
+	// 驱动创建的iptables规则, 删除网络时删除
+	IptablesRules []IptablesRule
+}
+
+// 网络的各个地址段, ipv4在前
+func (nw *Network) ipRanges() []*net.IPNet {
+	var ranges []*net.IPNet
+	for _, r := range []*net.IPNet{nw.IpRange, nw.IpRange6} {
+		if r != nil {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
 }
 
 func (nw *Network) dump(dumpPath string) error {
@@ -98,22 +114,14 @@ func (nw *Network) remove(dumpPath string) error {
 }
 
 func (nw *Network) load(dumpPath string) error {
-	// 打开配置文件
-	nwConfigFile, err := os.Open(dumpPath)
-	if err != nil {
-		return err
-	}
-	defer nwConfigFile.Close()
-
-	// 从配置文件中读取网络的配置json字符串
-	nwJson := make([]byte, 2000)
-	n, err := nwConfigFile.Read(nwJson)
+	// 读取配置文件中的json字符串, 网络记录了iptables规则, 文件大小不固定
+	nwJson, err := ioutil.ReadFile(dumpPath)
 	if err != nil {
 		return err
 	}
 
 	// json字符串反序列换出网络配置
-	err = json.Unmarshal(nwJson[:n], nw)
+	err = json.Unmarshal(nwJson, nw)
 	if err != nil {
 		logrus.Errorf("Error load nw info %v", err)
 		return err
@@ -185,31 +193,99 @@ func Init() error {
 	return nil
 }
 
-func CreateNetwork(dirver, subnet, name string) error {
-	// ParseCIDR是golang net包的函数，功能是将网段的字符串转换为net.IPNet的对象
-	_, cidr, _ := net.ParseCIDR(subnet)
-	// 通过IPAM分配网管IP,获取到网段中第一个IP作为网关的IP
-	gatewayIp, err := ipAllocator.Allocate(cidr)
+// 解析网段参数, 每个地址族最多一个网段, ipv6网段需要开启ipv6
+func parseSubnets(subnets []string, ipv6 bool) (cidr, cidr6 *net.IPNet, err error) {
+	for _, subnet := range subnets {
+		// ParseCIDR是golang net包的函数，功能是将网段的字符串转换为net.IPNet的对象
+		_, c, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid subnet %s: %v", subnet, err)
+		}
+		if c.IP.To4() != nil {
+			if cidr != nil {
+				return nil, nil, fmt.Errorf("multiple ipv4 subnets: %s, %s", cidr, c)
+			}
+			cidr = c
+			continue
+		}
+		if !ipv6 {
+			return nil, nil, fmt.Errorf("ipv6 subnet %s requires --ipv6", c)
+		}
+		if cidr6 != nil {
+			return nil, nil, fmt.Errorf("multiple ipv6 subnets: %s, %s", cidr6, c)
+		}
+		cidr6 = c
+	}
+	if ipv6 && cidr6 == nil {
+		return nil, nil, fmt.Errorf("--ipv6 requires an ipv6 subnet")
+	}
+	if cidr == nil && cidr6 == nil {
+		return nil, nil, fmt.Errorf("missing subnet")
+	}
+	return cidr, cidr6, nil
+}
+
+func CreateNetwork(dirver, name string, subnets []string, ipv6 bool) error {
+	if _, ok := networks[name]; ok {
+		return fmt.Errorf("network %s already exists", name)
+	}
+	driver, ok := drivers[dirver]
+	if !ok {
+		return fmt.Errorf("no such network driver: %s", dirver)
+	}
+	cidr, cidr6, err := parseSubnets(subnets, ipv6)
 	if err != nil {
 		return err
 	}
-	cidr.IP = gatewayIp
+	// 通过IPAM分配网管IP,获取到网段中第一个IP作为网关的IP
+	var gateways []string
+	var allocated []*net.IPNet
+	for _, c := range []*net.IPNet{cidr, cidr6} {
+		if c == nil {
+			continue
+		}
+		gatewayIp, err := ipAllocator.Allocate(c)
+		if err != nil {
+			releaseIPs(allocated)
+			return err
+		}
+		c.IP = gatewayIp
+		allocated = append(allocated, c)
+		gateways = append(gateways, c.String())
+	}
 
 	// 调用网络驱动的Create方法创建网络
-	nw, err := drivers[dirver].Create(cidr.String(), name)
+	nw, err := driver.Create(gateways, name)
 	if err != nil {
+		releaseIPs(allocated)
 		return err
 	}
 	// 保存网络信息，将网络信息保存到文件系统中
 	return nw.dump(defaultNetworkPath)
 }
 
+// 释放已分配的地址, 地址为网段中的IP
+func releaseIPs(addrs []*net.IPNet) {
+	for _, addr := range addrs {
+		if err := ipAllocator.Release(addr, &addr.IP); err != nil {
+			logrus.Errorf("release ip %s error %v", addr, err)
+		}
+	}
+}
+
 // 打印网络信息
 func ListNetwork() {
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	fmt.Fprint(w, "NAME\tIpRange\tDriver\n")
+	fmt.Fprint(w, "NAME\tIpRange\tIpRange6\tDriver\n")
 	for _, nw := range networks {
-		fmt.Fprintf(w, "%s\t%s\t%s\n", nw.Name, nw.IpRange.String(), nw.Driver)
+		ipRange, ipRange6 := "", ""
+		if nw.IpRange != nil {
+			ipRange = nw.IpRange.String()
+		}
+		if nw.IpRange6 != nil {
+			ipRange6 = nw.IpRange6.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", nw.Name, ipRange, ipRange6, nw.Driver)
 	}
 	if err := w.Flush(); err != nil {
 		logrus.Errorf("flush error %v", err)
@@ -224,9 +300,17 @@ func DeleteNetwork(networkName string) error {
 	if !ok {
 		return fmt.Errorf("no such network: %s", networkName)
 	}
+	// 还有容器连接的网络不能删除
+	for _, ep := range endpoints {
+		if ep.Network != nil && ep.Network.Name == nw.Name {
+			return fmt.Errorf("network %s has active endpoints", networkName)
+		}
+	}
 	// 调用IPAM的实例释放ipAllocator网络网关的IP
-	if err := ipAllocator.Release(nw.IpRange, &nw.IpRange.IP); err != nil {
-		return fmt.Errorf("error remove network gateway ip: %s", err)
+	for _, r := range nw.ipRanges() {
+		if err := ipAllocator.Release(r, &r.IP); err != nil {
+			return fmt.Errorf("error remove network gateway ip: %s", err)
+		}
 	}
 	// 调用驱动删除网络
 	if err := drivers[nw.Driver].Delete(*nw); err != nil {
@@ -236,29 +320,39 @@ func DeleteNetwork(networkName string) error {
 	return nw.remove(defaultNetworkPath)
 }
 
-func enterContainerNetns(enLink *netlink.Link, cinfo *container.ContainerInfo) func() {
+// 进入容器的net namespace, 返回恢复到原namespace的函数
+// 失败时仍停留在原来的namespace中, 避免在宿主机上配置容器的网络设备
+func enterContainerNetns(enLink *netlink.Link, cinfo *container.ContainerInfo) (func(), error) {
 	f, err := os.OpenFile(fmt.Sprintf("/proc/%s/ns/net", cinfo.Pid), os.O_RDONLY, 0)
 	if err != nil {
-		logrus.Errorf("error get container net namespace, %v", err)
+		return nil, fmt.Errorf("error get container net namespace, %v", err)
 	}
 
 	nsFD := f.Fd()
 	runtime.LockOSThread()
+	fail := func(err error) (func(), error) {
+		runtime.UnlockOSThread()
+		f.Close()
+		return nil, err
+	}
 
-	// 修改veth peer 另一端移到容器的namespace中
-	if err = netlink.LinkSetNsFd(*enLink, int(nsFD)); err != nil {
-		logrus.Errorf("error set link netns, error %v", err)
+	// 修改veth peer 另一端移到容器的namespace中, 为nil时只进入namespace
+	if enLink != nil {
+		if err = netlink.LinkSetNsFd(*enLink, int(nsFD)); err != nil {
+			return fail(fmt.Errorf("error set link netns, %v", err))
+		}
 	}
 
 	// 或得当前容器的namespace
 	origin, err := netns.Get()
 	if err != nil {
-		logrus.Errorf("error get current netns, %v", err)
+		return fail(fmt.Errorf("error get current netns, %v", err))
 	}
 
 	// 设置当前进程到新的网络namespace, 并在函数执行完成之后再恢复到之前的namespace
 	if err = netns.Set(netns.NsHandle(nsFD)); err != nil {
-		logrus.Errorf("error set netns, %v", err)
+		origin.Close()
+		return fail(fmt.Errorf("error set netns, %v", err))
 	}
 
 	return func() {
@@ -268,64 +362,171 @@ func enterContainerNetns(enLink *netlink.Link, cinfo *container.ContainerInfo) f
 		origin.Close()
 		runtime.UnlockOSThread()
 		f.Close()
+	}, nil
+}
+
+// 容器内第一个未使用的ethN接口名
+func nextInterfaceName() string {
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("eth%d", i)
+		if _, err := netlink.LinkByName(name); err != nil {
+			return name
+		}
 	}
 }
 
+// 容器中是否已经有对应地址族的默认路由
+func hasDefaultRoute(family int) bool {
+	routes, err := netlink.RouteList(nil, family)
+	if err != nil {
+		return false
+	}
+	for _, route := range routes {
+		if route.Dst == nil || route.Dst.IP.IsUnspecified() {
+			return true
+		}
+	}
+	return false
+}
+
 func configEndpointIpAddressAndRoute(ep *Endpoint, cinfo *container.ContainerInfo) error {
 	peerLink, err := netlink.LinkByName(ep.Device.PeerName)
 	if err != nil {
 		return fmt.Errorf("fail config endpoint: %v", err)
 	}
 
-	defer enterContainerNetns(&peerLink, cinfo)()
-	interfaceIp := *ep.Network.IpRange
-	interfaceIp.IP = ep.IPAddress
-	if err = setInterfaceIP(ep.Device.PeerName, interfaceIp.String()); err != nil {
-		return fmt.Errorf("%s,%v", ep.Network, err)
+	exitNetns, err := enterContainerNetns(&peerLink, cinfo)
+	if err != nil {
+		return fmt.Errorf("fail config endpoint: %v", err)
+	}
+	defer exitNetns()
+	// 移入容器后接口的index可能变化, 重新获取
+	if peerLink, err = netlink.LinkByName(ep.Device.PeerName); err != nil {
+		return fmt.Errorf("fail config endpoint: %v", err)
 	}
-	if err = setInterfaceUP(ep.Device.PeerName); err != nil {
+	// 每个网络端点在容器内依次命名为eth0, eth1...
+	ep.Interface = nextInterfaceName()
+	if err = netlink.LinkSetName(peerLink, ep.Interface); err != nil {
+		return fmt.Errorf("rename %s to %s error %v", ep.Device.PeerName, ep.Interface, err)
+	}
+	if ep.IPv6Address != nil {
+		// 容器内的ipv6可能被默认关闭, 需要在配置地址之前打开
+		if err = enableIPv6(ep.Interface); err != nil {
+			return err
+		}
+	}
+	for _, addr := range endpointAddrs(ep) {
+		if addr.ip == nil {
+			continue
+		}
+		interfaceIp := *addr.ipRange
+		interfaceIp.IP = addr.ip
+		if err = setInterfaceIP(ep.Interface, interfaceIp.String()); err != nil {
+			return fmt.Errorf("%s,%v", ep.Network, err)
+		}
+	}
+	if err = setInterfaceUP(ep.Interface); err != nil {
 		return err
 	}
 	if err = setInterfaceUP("lo"); err != nil {
 		return err
 	}
-	_, cidr, _ := net.ParseCIDR("0.0.0.0/0")
+	return addDefaultRoutes(ep, peerLink.Attrs().Index)
+}
+
+// 网络端点各个地址族的地址, 网段和默认路由
+type endpointAddr struct {
+	ipRange *net.IPNet
+	ip      net.IP
+	family  int
+	dst     string
+}
 
-	defaultRoute := &netlink.Route{
-		LinkIndex: peerLink.Attrs().Index,
-		Gw:        ep.Network.IpRange.IP,
-		Dst:       cidr,
+func endpointAddrs(ep *Endpoint) []endpointAddr {
+	return []endpointAddr{
+		{ep.Network.IpRange, ep.IPAddress, netlink.FAMILY_V4, "0.0.0.0/0"},
+		{ep.Network.IpRange6, ep.IPv6Address, netlink.FAMILY_V6, "::/0"},
 	}
-	if err = netlink.RouteAdd(defaultRoute); err != nil {
-		return err
+}
+
+// 添加经由网络网关的默认路由, 需要在容器的net namespace中调用
+// 默认路由由容器的主网络提供, 已经有默认路由的地址族跳过
+func addDefaultRoutes(ep *Endpoint, linkIndex int) error {
+	for _, addr := range endpointAddrs(ep) {
+		if addr.ip == nil || hasDefaultRoute(addr.family) {
+			continue
+		}
+		_, cidr, _ := net.ParseCIDR(addr.dst)
+
+		defaultRoute := &netlink.Route{
+			LinkIndex: linkIndex,
+			Gw:        addr.ipRange.IP,
+			Dst:       cidr,
+		}
+		if err := netlink.RouteAdd(defaultRoute); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// 主网络断开后, 将另一个网络端点设置为容器的默认路由
+func promoteDefaultRoute(ep *Endpoint, cinfo *container.ContainerInfo) error {
+	if _, err := os.Stat(fmt.Sprintf("/proc/%s/ns/net", cinfo.Pid)); err != nil {
+		return fmt.Errorf("container %s is not running", cinfo.Name)
+	}
+	exitNetns, err := enterContainerNetns(nil, cinfo)
+	if err != nil {
+		return err
+	}
+	defer exitNetns()
+	link, err := netlink.LinkByName(ep.Interface)
+	if err != nil {
+		return err
+	}
+	return addDefaultRoutes(ep, link.Attrs().Index)
+}
+
+// 端口映射的iptables规则
+// PREROUTING和OUTPUT链的DNAT分别处理外部和宿主机本地的访问
+// POSTROUTING的MASQUERADE处理容器通过宿主机端口访问自身的回环流量
+func portMappingRules(bridgeName string, ip net.IP, pb container.PortBinding) []IptablesRule {
+	proto := pb.Protocol
+	dst := ""
+	if pb.HostIP != "" && !net.ParseIP(pb.HostIP).IsUnspecified() {
+		dst = fmt.Sprintf("-d %s ", pb.HostIP)
+	}
+	// ipv6地址需要用[]包裹, 与端口区分
+	dnat := fmt.Sprintf("-p %s %s-m addrtype --dst-type LOCAL -m %s --dport %d -j DNAT --to-destination %s",
+		proto, dst, proto, pb.HostPort, net.JoinHostPort(ip.String(), strconv.Itoa(pb.ContainerPort)))
+	return []IptablesRule{
+		newIptablesRule(ip, "nat", "PREROUTING", false, dnat),
+		newIptablesRule(ip, "nat", "OUTPUT", false, dnat),
+		newIptablesRule(ip, "nat", "POSTROUTING", false,
+			fmt.Sprintf("-p %s -s %s -d %s -m %s --dport %d -j MASQUERADE", proto, ip, ip, proto, pb.ContainerPort)),
+		newIptablesRule(ip, "filter", "FORWARD", true,
+			fmt.Sprintf("-p %s -d %s ! -i %s -o %s -m %s --dport %d -j ACCEPT", proto, ip, bridgeName, bridgeName, proto, pb.ContainerPort)),
+	}
+}
+
+// 配置端口映射的iptables规则, 添加的规则记录在网络端点中
 func configPortMapping(ep *Endpoint, _ *container.ContainerInfo) error {
-	for _, pm := range ep.PortMapping {
-		PortMapping := strings.Split(pm, ":")
-		if len(PortMapping) != 2 {
-			logrus.Errorf("port mapping format error, %v", pm)
-			continue
+	for _, pb := range ep.Ports {
+		var hostIP net.IP
+		if pb.HostIP != "" {
+			hostIP = net.ParseIP(pb.HostIP)
 		}
-		iptablesCmd := fmt.Sprintf("-t nat -A PREROUTING -p tcp -m tcp --dport %s -j DNAT --to %s:%s",
-			PortMapping[0], ep.IPAddress.String(), PortMapping[1])
-		preIptablesCmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
-		output, err := preIptablesCmd.Output()
-		if err != nil {
-			logrus.Errorf("iptables output, %v", output)
-			continue
+		for _, ip := range []net.IP{ep.IPAddress, ep.IPv6Address} {
+			// 指定了宿主机地址时只配置同一地址族的规则
+			if ip == nil || (hostIP != nil && (hostIP.To4() == nil) != (ip.To4() == nil)) {
+				continue
+			}
+			rules := portMappingRules(ep.Network.Name, ip, pb)
+			if err := addIptablesRules(rules); err != nil {
+				return fmt.Errorf("port mapping %s error %v", pb, err)
+			}
+			ep.IptablesRules = append(ep.IptablesRules, rules...)
 		}
-
-		// iptablesCmd = fmt.Sprintf("-t nat -A POSTROUTING -p tcp -m tcp -d %s --dport %s -j MASQUERADE",
-		// 	ep.IPAddress.String(), PortMapping[1])
-		// postIptablesCmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
-		// output, err = postIptablesCmd.Output()
-		// if err != nil {
-		// 	logrus.Errorf("iptables output, %v", output)
-		// 	continue
-		// }
 	}
 	return nil
 }
@@ -336,30 +537,116 @@ func Connect(networkName string, cinfo *container.ContainerInfo) error {
 	if !ok {
 		return fmt.Errorf("no such network: %s", networkName)
 	}
+	epId := GetEndpointId(networkName, cinfo)
+	if _, ok := endpoints[epId]; ok {
+		return fmt.Errorf("container %s is already connected to network %s", cinfo.Name, networkName)
+	}
+	// 静态地址和端口映射只用于容器连接的第一个网络
+	primary := len(cinfo.Networks) == 0
+
+	// 容器指定的静态地址
+	var static, static6 net.IP
+	var mac net.HardwareAddr
+	if hc := cinfo.HostConfig; hc != nil && primary {
+		static, static6 = net.ParseIP(hc.IPAddress), net.ParseIP(hc.IPv6Address)
+		if hc.MacAddress != "" {
+			var err error
+			if mac, err = net.ParseMAC(hc.MacAddress); err != nil {
+				return err
+			}
+		}
+	}
+	if static != nil && network.IpRange == nil {
+		return fmt.Errorf("network %s has no ipv4 subnet for ip %s", networkName, static)
+	}
+	if static6 != nil && network.IpRange6 == nil {
+		return fmt.Errorf("network %s has no ipv6 subnet for ip %s", networkName, static6)
+	}
 
-	// 调用IPAM从网络的网段中分配容器IP
-	ip, err := ipAllocator.Allocate(network.IpRange)
-	if err != nil {
-		return err
+	// 调用IPAM从网络的网段中分配容器IP, 指定了静态地址时预留该地址
+	var ip, ip6 net.IP
+	var allocated []*net.IPNet
+	for _, r := range network.ipRanges() {
+		addr := static
+		if r.IP.To4() == nil {
+			addr = static6
+		}
+		var err error
+		if addr != nil {
+			err = ipAllocator.Reserve(r, addr)
+		} else {
+			addr, err = ipAllocator.Allocate(r)
+		}
+		if err != nil {
+			releaseIPs(allocated)
+			return err
+		}
+		allocated = append(allocated, &net.IPNet{IP: addr, Mask: r.Mask})
+		if addr.To4() != nil {
+			ip = addr
+		} else {
+			ip6 = addr
+		}
 	}
 	// 创建网络端点
 	ep := &Endpoint{
-		ID:          fmt.Sprintf("%s-%s", cinfo.Id, networkName),
-		IPAddress:   ip,
-		Network:     network,
-		PortMapping: cinfo.PortMapping,
+		ID:            epId,
+		ContainerId:   cinfo.Id,
+		ContainerName: cinfo.Name,
+		IPAddress:     ip,
+		IPv6Address:   ip6,
+		MacAddress:    mac,
+		Network:       network,
+	}
+	if primary {
+		ep.Ports = cinfo.Ports
 	}
 	// 调用网络驱动挂载和配置网络端点
-	if err = drivers[network.Driver].Connect(network, ep); err != nil {
+	if err := drivers[network.Driver].Connect(network, ep); err != nil {
+		releaseIPs(allocated)
 		return err
 	}
 	// 到容器的namespace配置容器的网络设备IP地址
-	if err = configEndpointIpAddressAndRoute(ep, cinfo); err != nil {
+	if err := configEndpointIpAddressAndRoute(ep, cinfo); err != nil {
+		if err := drivers[network.Driver].Disconnect(*network, ep); err != nil {
+			logrus.Errorf("remove endpoint %s error %v", ep.ID, err)
+		}
+		releaseIPs(allocated)
 		return err
 	}
-	endpoints[ep.ID] = ep
 	// 配置容器到宿主机的映射
-	return configPortMapping(ep, cinfo)
+	if err := configPortMapping(ep, cinfo); err != nil {
+		deleteIptablesRules(ep.IptablesRules)
+		if err := drivers[network.Driver].Disconnect(*network, ep); err != nil {
+			logrus.Errorf("remove endpoint %s error %v", ep.ID, err)
+		}
+		releaseIPs(allocated)
+		return err
+	}
+	endpoints[ep.ID] = ep
+	if err := ep.dump(defaultEndpointPath); err != nil {
+		logrus.Errorf("save endpoint %s error %v", ep.ID, err)
+	}
+	settings := &container.NetworkSettings{
+		Interface:  ep.Interface,
+		MacAddress: ep.MacAddress.String(),
+	}
+	if ip != nil {
+		settings.IPAddress = ip.String()
+	}
+	if ip6 != nil {
+		settings.IPv6Address = ip6.String()
+	}
+	if cinfo.Networks == nil {
+		cinfo.Networks = map[string]*container.NetworkSettings{}
+	}
+	cinfo.Networks[networkName] = settings
+	if primary {
+		cinfo.IPAddress = settings.IPAddress
+		cinfo.IPv6Address = settings.IPv6Address
+		cinfo.MacAddress = settings.MacAddress
+	}
+	return nil
 }
 
 func Disconnect(networkName string, cinfo *container.ContainerInfo) error {
@@ -368,14 +655,145 @@ func Disconnect(networkName string, cinfo *container.ContainerInfo) error {
 	if !ok {
 		return fmt.Errorf("no such network: %s", networkName)
 	}
-	epId := fmt.Sprintf("%s-%s", cinfo.Id, networkName)
+	epId := GetEndpointId(networkName, cinfo)
 	ep, ok := endpoints[epId]
 	if !ok {
-		return fmt.Errorf("no such endpoint: %s", networkName)
+		return fmt.Errorf("container %s is not connected to network %s", cinfo.Name, networkName)
 	}
-	// 调用IPAM的实例释放ipAllocator网络网关的IP
-	if err := ipAllocator.Release(nw.IpRange, &ep.IPAddress); err != nil {
-		return fmt.Errorf("error remove network gateway ip: %s", err)
+	// 删除端口映射的iptables规则
+	if err := deleteIptablesRules(ep.IptablesRules); err != nil {
+		logrus.Errorf("remove port mapping of endpoint %s error %v", ep.ID, err)
+	}
+	// 调用网络驱动删除网络端点的设备
+	if err := drivers[nw.Driver].Disconnect(*nw, ep); err != nil {
+		return fmt.Errorf("error remove endpoint %s: %v", ep.ID, err)
+	}
+	// 调用IPAM的实例释放容器的IP
+	if ep.IPAddress != nil && nw.IpRange != nil {
+		if err := ipAllocator.Release(nw.IpRange, &ep.IPAddress); err != nil {
+			return fmt.Errorf("error remove network gateway ip: %s", err)
+		}
+	}
+	if ep.IPv6Address != nil && nw.IpRange6 != nil {
+		if err := ipAllocator.Release(nw.IpRange6, &ep.IPv6Address); err != nil {
+			return fmt.Errorf("error remove network gateway ip: %s", err)
+		}
+	}
+	delete(endpoints, epId)
+	if err := ep.remove(defaultEndpointPath); err != nil {
+		logrus.Errorf("remove endpoint %s file error %v", ep.ID, err)
+	}
+
+	// 端口映射的规则已经随端点删除, 容器不再发布这些端口
+	if len(ep.Ports) > 0 {
+		cinfo.Ports = nil
+	}
+	settings := cinfo.Networks[networkName]
+	delete(cinfo.Networks, networkName)
+	// 断开的是主网络时, 由剩下的网络提供容器地址和默认路由
+	// 无法添加默认路由时(如容器已经退出)不切换主网络
+	if settings != nil && settings.IPAddress == cinfo.IPAddress && settings.IPv6Address == cinfo.IPv6Address {
+		cinfo.IPAddress, cinfo.IPv6Address, cinfo.MacAddress = "", "", ""
+		for otherName, other := range cinfo.Networks {
+			otherEp, ok := endpoints[GetEndpointId(otherName, cinfo)]
+			if !ok {
+				continue
+			}
+			if err := promoteDefaultRoute(otherEp, cinfo); err != nil {
+				logrus.Warnf("set default route of network %s error %v", otherName, err)
+				continue
+			}
+			cinfo.IPAddress, cinfo.IPv6Address, cinfo.MacAddress = other.IPAddress, other.IPv6Address, other.MacAddress
+			break
+		}
+	}
+	return nil
+}
+
+// 断开容器连接的所有网络, 包括没有记录在容器信息中的网络端点
+func DisconnectAll(cinfo *container.ContainerInfo) error {
+	var lastErr error
+	for _, ep := range endpoints {
+		if ep.ContainerId != cinfo.Id && !strings.HasPrefix(ep.ID, cinfo.Id+"-") {
+			continue
+		}
+		networkName := strings.TrimPrefix(ep.ID, cinfo.Id+"-")
+		if ep.Network != nil {
+			networkName = ep.Network.Name
+		}
+		if err := Disconnect(networkName, cinfo); err != nil {
+			logrus.Errorf("disconnect %s from network %s error %v", cinfo.Name, networkName, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// 网络详情中的网络端点
+type endpointInspect struct {
+	ID            string `json:"id"`
+	ContainerId   string `json:"containerId"`
+	ContainerName string `json:"containerName"`
+	IPAddress     string `json:"ip,omitempty"`
+	IPv6Address   string `json:"ip6,omitempty"`
+	MacAddress    string `json:"mac,omitempty"`
+}
+
+// 网络详情
+type networkInspect struct {
+	Name      string            `json:"name"`
+	Driver    string            `json:"driver"`
+	Subnet    string            `json:"subnet,omitempty"`
+	Gateway   string            `json:"gateway,omitempty"`
+	Subnet6   string            `json:"subnet6,omitempty"`
+	Gateway6  string            `json:"gateway6,omitempty"`
+	Endpoints []endpointInspect `json:"endpoints"`
+}
+
+// 打印网络的网段, 网关, 驱动和连接的网络端点
+func InspectNetwork(networkName string) error {
+	nw, ok := networks[networkName]
+	if !ok {
+		return fmt.Errorf("no such network: %s", networkName)
+	}
+	info := networkInspect{
+		Name:      nw.Name,
+		Driver:    nw.Driver,
+		Endpoints: []endpointInspect{},
+	}
+	if nw.IpRange != nil {
+		_, subnet, _ := net.ParseCIDR(nw.IpRange.String())
+		info.Subnet, info.Gateway = subnet.String(), nw.IpRange.IP.String()
+	}
+	if nw.IpRange6 != nil {
+		_, subnet, _ := net.ParseCIDR(nw.IpRange6.String())
+		info.Subnet6, info.Gateway6 = subnet.String(), nw.IpRange6.IP.String()
+	}
+	for _, ep := range endpoints {
+		if ep.Network == nil || ep.Network.Name != nw.Name {
+			continue
+		}
+		epInfo := endpointInspect{
+			ID:            ep.ID,
+			ContainerId:   ep.ContainerId,
+			ContainerName: ep.ContainerName,
+			MacAddress:    ep.MacAddress.String(),
+		}
+		if ep.IPAddress != nil {
+			epInfo.IPAddress = ep.IPAddress.String()
+		}
+		if ep.IPv6Address != nil {
+			epInfo.IPv6Address = ep.IPv6Address.String()
+		}
+		info.Endpoints = append(info.Endpoints, epInfo)
+	}
+	sort.Slice(info.Endpoints, func(i, j int) bool {
+		return info.Endpoints[i].ID < info.Endpoints[j].ID
+	})
+	content, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
 	}
+	fmt.Println(string(content))
 	return nil
 }
@@ -0,0 +1,44 @@
+package network
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// 容器网卡收发的字节数
+type NetStats struct {
+	RxBytes uint64 `json:"rxBytes"`
+	TxBytes uint64 `json:"txBytes"`
+}
+
+// 在容器的net namespace中读取除lo之外所有网卡的统计
+func GetContainerNetStats(pid string) (*NetStats, error) {
+	ns, err := netns.GetFromPath(fmt.Sprintf("/proc/%s/ns/net", pid))
+	if err != nil {
+		return nil, fmt.Errorf("get container %s net namespace error %v", pid, err)
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, fmt.Errorf("create netlink handle error %v", err)
+	}
+	defer handle.Delete()
+
+	links, err := handle.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("list container links error %v", err)
+	}
+	stats := &NetStats{}
+	for _, link := range links {
+		attrs := link.Attrs()
+		if attrs.Flags&net.FlagLoopback != 0 || attrs.Statistics == nil {
+			continue
+		}
+		stats.RxBytes += attrs.Statistics.RxBytes
+		stats.TxBytes += attrs.Statistics.TxBytes
+	}
+	return stats, nil
+}
@@ -3,6 +3,7 @@ package nsenter
 /*
 #cgo CFLAGS: -Wall
 #define _GNU_SOURCE
+#include <grp.h>
 #include <sched.h>
 #include <stdio.h>
 #include <stdlib.h>
@@ -46,6 +47,36 @@ __attribute__((constructor)) void enter_namespace(void) {
     }
     close(fd);
   }
+
+  // 切换到指定的用户和组
+  char *minidocker_uid = getenv("minidocker_uid");
+  char *minidocker_gid = getenv("minidocker_gid");
+  char *minidocker_groups = getenv("minidocker_groups");
+  if (minidocker_uid && minidocker_gid) {
+    gid_t groups[64];
+    int ngroups = 0;
+    if (minidocker_groups && strlen(minidocker_groups) > 0) {
+      char *groups_str = strdup(minidocker_groups);
+      char *gid = strtok(groups_str, ",");
+      while (gid && ngroups < 64) {
+        groups[ngroups++] = atoi(gid);
+        gid = strtok(NULL, ",");
+      }
+      free(groups_str);
+    }
+    if (setgroups(ngroups, groups) == -1) {
+      printf("failed to setgroups %s\n", minidocker_groups);
+      exit(1);
+    }
+    if (setgid(atoi(minidocker_gid)) == -1) {
+      printf("failed to setgid %s\n", minidocker_gid);
+      exit(1);
+    }
+    if (setuid(atoi(minidocker_uid)) == -1) {
+      printf("failed to setuid %s\n", minidocker_uid);
+      exit(1);
+    }
+  }
   exit(system(minidocker_command));
   return;
 }
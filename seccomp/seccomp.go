@@ -0,0 +1,380 @@
+package seccomp
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+//go:embed default.json
+var defaultProfile []byte
+
+// seccomp filter的返回值, 见 linux/seccomp.h
+const (
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retTrap        = 0x00030000
+	retErrno       = 0x00050000
+	retTrace       = 0x7ff00000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+
+	// struct seccomp_data 中各字段的偏移
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+
+	// x32 ABI的系统调用号带有该标记位
+	x32SyscallBit = 0x40000000
+)
+
+type Action string
+
+const (
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActKillThread  Action = "SCMP_ACT_KILL_THREAD"
+	ActTrap        Action = "SCMP_ACT_TRAP"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActTrace       Action = "SCMP_ACT_TRACE"
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+	ActLog         Action = "SCMP_ACT_LOG"
+)
+
+type Operator string
+
+const (
+	OpNotEqual     Operator = "SCMP_CMP_NE"
+	OpLessThan     Operator = "SCMP_CMP_LT"
+	OpLessEqual    Operator = "SCMP_CMP_LE"
+	OpEqualTo      Operator = "SCMP_CMP_EQ"
+	OpGreaterEqual Operator = "SCMP_CMP_GE"
+	OpGreaterThan  Operator = "SCMP_CMP_GT"
+	OpMaskedEqual  Operator = "SCMP_CMP_MASKED_EQ"
+)
+
+// seccomp配置, 兼容Docker/OCI的profile格式
+type Profile struct {
+	DefaultAction   Action         `json:"defaultAction"`
+	DefaultErrnoRet *uint          `json:"defaultErrnoRet,omitempty"`
+	Architectures   []string       `json:"architectures,omitempty"`
+	ArchMap         []Architecture `json:"archMap,omitempty"`
+	Syscalls        []*Syscall     `json:"syscalls"`
+}
+
+type Architecture struct {
+	Arch      string   `json:"architecture"`
+	SubArches []string `json:"subArchitectures"`
+}
+
+type Syscall struct {
+	Name     string   `json:"name,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []*Arg   `json:"args"`
+	Comment  string   `json:"comment"`
+	Includes Filter   `json:"includes"`
+	Excludes Filter   `json:"excludes"`
+}
+
+// 按capability和架构决定规则是否生效
+type Filter struct {
+	Caps      []string `json:"caps,omitempty"`
+	Arches    []string `json:"arches,omitempty"`
+	MinKernel string   `json:"minKernel,omitempty"`
+}
+
+type Arg struct {
+	Index    uint     `json:"index"`
+	Value    uint64   `json:"value"`
+	ValueTwo uint64   `json:"valueTwo"`
+	Op       Operator `json:"op"`
+}
+
+// 内置的默认配置, 屏蔽kexec_load, mount等危险的系统调用
+func DefaultProfile() []byte {
+	return defaultProfile
+}
+
+// 解析profile
+func LoadProfile(content []byte) (*Profile, error) {
+	var profile Profile
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return nil, fmt.Errorf("decode seccomp profile error %v", err)
+	}
+	if profile.DefaultAction == "" {
+		return nil, fmt.Errorf("seccomp profile missing defaultAction")
+	}
+	return &profile, nil
+}
+
+func nativeArchName() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "SCMP_ARCH_X86_64"
+	case "arm64":
+		return "SCMP_ARCH_AARCH64"
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断规则对当前架构和容器的capability是否生效
+func (s *Syscall) enabled(caps []string) bool {
+	arch := nativeArchName()
+	if len(s.Includes.Arches) > 0 && !contains(s.Includes.Arches, arch) {
+		return false
+	}
+	if len(s.Excludes.Arches) > 0 && contains(s.Excludes.Arches, arch) {
+		return false
+	}
+	for _, c := range s.Includes.Caps {
+		if !contains(caps, c) {
+			return false
+		}
+	}
+	for _, c := range s.Excludes.Caps {
+		if contains(caps, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// 转换为filter的返回值
+func actionValue(action Action, errnoRet *uint, defaultErrno uint) (uint32, error) {
+	errno := defaultErrno
+	if errnoRet != nil {
+		errno = *errnoRet
+	}
+	switch action {
+	case ActKill, ActKillThread:
+		return retKillThread, nil
+	case ActKillProcess:
+		return retKillProcess, nil
+	case ActTrap:
+		return retTrap, nil
+	case ActErrno:
+		return retErrno | uint32(errno&0xffff), nil
+	case ActTrace:
+		return retTrace | uint32(errno&0xffff), nil
+	case ActAllow:
+		return retAllow, nil
+	case ActLog:
+		return retLog, nil
+	}
+	return 0, fmt.Errorf("unsupported seccomp action %s", action)
+}
+
+// 带有跳转标记的BPF指令, fail表示条件不满足时跳转到当前规则的末尾
+type instruction struct {
+	unix.SockFilter
+	jtFail bool
+	jfFail bool
+}
+
+func stmt(code uint16, k uint32) instruction {
+	return instruction{SockFilter: unix.SockFilter{Code: code, K: k}}
+}
+
+func jump(code uint16, k uint32, jt uint8, jf uint8) instruction {
+	return instruction{SockFilter: unix.SockFilter{Code: code, K: k, Jt: jt, Jf: jf}}
+}
+
+func loadAbs(offset uint32) instruction {
+	return stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offset)
+}
+
+// 参数是64位的, 而BPF只能比较32位, 需要分别比较高低32位
+func compileArg(arg *Arg) ([]instruction, error) {
+	if arg.Index > 5 {
+		return nil, fmt.Errorf("invalid syscall argument index %d", arg.Index)
+	}
+	lo := offsetArgs + 8*uint32(arg.Index)
+	hi := lo + 4
+	value, valueTwo := arg.Value, arg.ValueTwo
+	vhi, vlo := uint32(value>>32), uint32(value)
+
+	const (
+		jeq = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jgt = unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K
+		jge = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		and = unix.BPF_ALU | unix.BPF_AND | unix.BPF_K
+	)
+	switch arg.Op {
+	case OpEqualTo:
+		return []instruction{
+			loadAbs(hi),
+			{SockFilter: unix.SockFilter{Code: jeq, K: vhi}, jfFail: true},
+			loadAbs(lo),
+			{SockFilter: unix.SockFilter{Code: jeq, K: vlo}, jfFail: true},
+		}, nil
+	case OpNotEqual:
+		return []instruction{
+			loadAbs(hi),
+			jump(jeq, vhi, 0, 2),
+			loadAbs(lo),
+			{SockFilter: unix.SockFilter{Code: jeq, K: vlo}, jtFail: true},
+		}, nil
+	case OpMaskedEqual:
+		// value是掩码, valueTwo是期望值
+		return []instruction{
+			loadAbs(hi),
+			stmt(and, vhi),
+			{SockFilter: unix.SockFilter{Code: jeq, K: uint32(valueTwo >> 32)}, jfFail: true},
+			loadAbs(lo),
+			stmt(and, vlo),
+			{SockFilter: unix.SockFilter{Code: jeq, K: uint32(valueTwo)}, jfFail: true},
+		}, nil
+	case OpGreaterThan, OpGreaterEqual:
+		last := uint16(jgt)
+		if arg.Op == OpGreaterEqual {
+			last = jge
+		}
+		return []instruction{
+			loadAbs(hi),
+			jump(jgt, vhi, 3, 0),
+			{SockFilter: unix.SockFilter{Code: jeq, K: vhi}, jfFail: true},
+			loadAbs(lo),
+			{SockFilter: unix.SockFilter{Code: last, K: vlo}, jfFail: true},
+		}, nil
+	case OpLessThan, OpLessEqual:
+		last := uint16(jge)
+		if arg.Op == OpLessEqual {
+			last = jgt
+		}
+		return []instruction{
+			loadAbs(hi),
+			{SockFilter: unix.SockFilter{Code: jgt, K: vhi}, jtFail: true},
+			jump(jeq, vhi, 0, 2),
+			loadAbs(lo),
+			{SockFilter: unix.SockFilter{Code: last, K: vlo}, jtFail: true},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported seccomp operator %s", arg.Op)
+}
+
+// 将profile编译为BPF程序, caps为容器拥有的capability, 用于处理includes/excludes
+func Compile(profile *Profile, caps []string) ([]unix.SockFilter, error) {
+	if nativeArch == 0 {
+		return nil, fmt.Errorf("seccomp is not supported on %s", runtime.GOARCH)
+	}
+	defaultErrno := uint(unix.EPERM)
+	if profile.DefaultErrnoRet != nil {
+		defaultErrno = *profile.DefaultErrnoRet
+	}
+	defaultAction, err := actionValue(profile.DefaultAction, nil, defaultErrno)
+	if err != nil {
+		return nil, err
+	}
+
+	const (
+		jeq = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jge = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		ret = unix.BPF_RET | unix.BPF_K
+	)
+	// 非本机架构的系统调用直接杀死进程
+	prog := []unix.SockFilter{
+		loadAbs(offsetArch).SockFilter,
+		jump(jeq, nativeArch, 1, 0).SockFilter,
+		stmt(ret, retKillProcess).SockFilter,
+		loadAbs(offsetNr).SockFilter,
+	}
+	if nativeArch == 0xc000003e {
+		// 防止通过x32 ABI绕过规则
+		prog = append(prog,
+			jump(jge, x32SyscallBit, 0, 1).SockFilter,
+			stmt(ret, retKillProcess).SockFilter)
+	}
+
+	for _, call := range profile.Syscalls {
+		if !call.enabled(caps) {
+			continue
+		}
+		action, err := actionValue(call.Action, call.ErrnoRet, uint(unix.EPERM))
+		if err != nil {
+			return nil, err
+		}
+		// 与默认行为相同且没有参数条件的规则不需要生成
+		if action == defaultAction && len(call.Args) == 0 {
+			continue
+		}
+		names := call.Names
+		if call.Name != "" {
+			names = append([]string{call.Name}, names...)
+		}
+
+		var body []instruction
+		for _, arg := range call.Args {
+			ins, err := compileArg(arg)
+			if err != nil {
+				return nil, err
+			}
+			body = append(body, ins...)
+		}
+		body = append(body, stmt(ret, action))
+		if len(body) > 255 {
+			return nil, fmt.Errorf("too many argument conditions for syscall %v", names)
+		}
+		// 解析跳转到规则末尾的偏移
+		for i := range body {
+			if body[i].jtFail {
+				body[i].Jt = uint8(len(body) - i - 1)
+			}
+			if body[i].jfFail {
+				body[i].Jf = uint8(len(body) - i - 1)
+			}
+		}
+
+		for _, name := range names {
+			nr, ok := syscallTable[name]
+			if !ok {
+				// 当前架构没有该系统调用
+				continue
+			}
+			prog = append(prog, jump(jeq, nr, 0, uint8(len(body))).SockFilter)
+			for _, ins := range body {
+				prog = append(prog, ins.SockFilter)
+			}
+			if len(call.Args) > 0 {
+				// 参数比较覆盖了累加器, 需要重新加载系统调用号
+				prog = append(prog, loadAbs(offsetNr).SockFilter)
+			}
+		}
+	}
+	prog = append(prog, stmt(ret, defaultAction).SockFilter)
+	if len(prog) > 4096 {
+		return nil, fmt.Errorf("seccomp program too long: %d instructions", len(prog))
+	}
+	return prog, nil
+}
+
+// 为当前线程安装seccomp filter, 调用前需要设置no_new_privs或拥有CAP_SYS_ADMIN
+func InitSeccomp(filter []unix.SockFilter) error {
+	if len(filter) == 0 {
+		return nil
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_PRCTL, unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER,
+		uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("prctl PR_SET_SECCOMP error %v", errno)
+	}
+	runtime.KeepAlive(filter)
+	return nil
+}
@@ -0,0 +1,134 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// 简单的BPF解释器, 用于验证生成的程序
+func runFilter(t *testing.T, prog []unix.SockFilter, arch uint32, nr uint32, args [6]uint64) uint32 {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[offsetNr:], nr)
+	binary.LittleEndian.PutUint32(data[offsetArch:], arch)
+	for i, arg := range args {
+		binary.LittleEndian.PutUint64(data[offsetArgs+8*i:], arg)
+	}
+	var a uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			a = binary.LittleEndian.Uint32(data[ins.K:])
+		case unix.BPF_ALU | unix.BPF_AND | unix.BPF_K:
+			a &= ins.K
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			pc += jumpOffset(a == ins.K, ins)
+		case unix.BPF_JMP | unix.BPF_JGT | unix.BPF_K:
+			pc += jumpOffset(a > ins.K, ins)
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			pc += jumpOffset(a >= ins.K, ins)
+		default:
+			t.Fatalf("unknown instruction %#v", ins)
+		}
+	}
+	t.Fatalf("program does not return")
+	return 0
+}
+
+func jumpOffset(cond bool, ins unix.SockFilter) int {
+	if cond {
+		return int(ins.Jt)
+	}
+	return int(ins.Jf)
+}
+
+func compileProfile(t *testing.T, content string, caps []string) []unix.SockFilter {
+	profile, err := LoadProfile([]byte(content))
+	if err != nil {
+		t.Fatalf("load profile error %v", err)
+	}
+	prog, err := Compile(profile, caps)
+	if err != nil {
+		t.Fatalf("compile profile error %v", err)
+	}
+	return prog
+}
+
+func TestDefaultProfile(t *testing.T) {
+	if nativeArch == 0 {
+		t.Skip("unsupported arch")
+	}
+	prog := compileProfile(t, string(DefaultProfile()), []string{"CAP_CHOWN"})
+	t.Logf("default profile: %d instructions", len(prog))
+
+	var args [6]uint64
+	if ret := runFilter(t, prog, nativeArch, syscallTable["kexec_load"], args); ret != retErrno|uint32(unix.EPERM) {
+		t.Errorf("kexec_load should be blocked, got %#x", ret)
+	}
+	if ret := runFilter(t, prog, nativeArch, syscallTable["mount"], args); ret != retErrno|uint32(unix.EPERM) {
+		t.Errorf("mount should be blocked, got %#x", ret)
+	}
+	if ret := runFilter(t, prog, nativeArch, syscallTable["read"], args); ret != retAllow {
+		t.Errorf("read should be allowed, got %#x", ret)
+	}
+	if ret := runFilter(t, prog, 0x40000003, syscallTable["read"], args); ret != retKillProcess {
+		t.Errorf("foreign arch should be killed, got %#x", ret)
+	}
+	args[0] = 8
+	if ret := runFilter(t, prog, nativeArch, syscallTable["personality"], args); ret != retAllow {
+		t.Errorf("personality(8) should be allowed, got %#x", ret)
+	}
+	args[0] = 0x0040000
+	if ret := runFilter(t, prog, nativeArch, syscallTable["personality"], args); ret != retErrno|uint32(unix.EPERM) {
+		t.Errorf("personality(0x40000) should be blocked, got %#x", ret)
+	}
+
+	// 拥有CAP_SYS_ADMIN时允许mount
+	prog = compileProfile(t, string(DefaultProfile()), []string{"CAP_SYS_ADMIN"})
+	if ret := runFilter(t, prog, nativeArch, syscallTable["mount"], args); ret != retAllow {
+		t.Errorf("mount should be allowed with CAP_SYS_ADMIN, got %#x", ret)
+	}
+}
+
+func TestArgOperators(t *testing.T) {
+	if nativeArch == 0 {
+		t.Skip("unsupported arch")
+	}
+	profile := `{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"syscalls": [
+			{"names": ["read"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 4294967296, "op": "SCMP_CMP_GT"}]},
+			{"names": ["write"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 1, "value": 10, "op": "SCMP_CMP_LE"}]},
+			{"names": ["close"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 3, "op": "SCMP_CMP_NE"}]},
+			{"names": ["socket"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 2, "value": 255, "valueTwo": 17, "op": "SCMP_CMP_MASKED_EQ"}]}
+		]
+	}`
+	prog := compileProfile(t, profile, nil)
+	deny := uint32(retErrno | uint32(unix.EPERM))
+	cases := []struct {
+		name string
+		args [6]uint64
+		want uint32
+	}{
+		{"read", [6]uint64{1 << 32}, deny},
+		{"read", [6]uint64{1<<32 + 1}, retAllow},
+		{"read", [6]uint64{2 << 32}, retAllow},
+		{"write", [6]uint64{0, 10}, retAllow},
+		{"write", [6]uint64{0, 11}, deny},
+		{"write", [6]uint64{0, 1 << 32}, deny},
+		{"close", [6]uint64{3}, deny},
+		{"close", [6]uint64{4}, retAllow},
+		{"close", [6]uint64{3 + 1<<32}, retAllow},
+		{"socket", [6]uint64{0, 0, 0x111}, retAllow},
+		{"socket", [6]uint64{0, 0, 0x112}, deny},
+	}
+	for _, c := range cases {
+		if ret := runFilter(t, prog, nativeArch, syscallTable[c.name], c.args); ret != c.want {
+			t.Errorf("%s%v: expect %#x, got %#x", c.name, c.args, c.want, ret)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !amd64 && !arm64
+// +build !amd64,!arm64
+
+package seccomp
+
+// 未支持的架构, Compile会返回错误
+const nativeArch = 0
+
+var syscallTable = map[string]uint32{}